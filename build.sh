@@ -1,11 +1,11 @@
 #!/usr/bin/env bash
 
 build() {
-    go build -o bookTracker src/*.go
+    go build -tags sqlite_fts5 -o bookTracker src/*.go
 }
 
 run() {
-    go run src/*.go $*
+    go run -tags sqlite_fts5 src/*.go $*
 }
 
 case "$1" in
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// the roles a person can have on a book, books.author is the people with the
+// author role joined with " & " so it can still be shown and searched as is
+var AUTHOR_ROLES = []string{"author", "translator", "illustrator", "narrator"}
+
+var CREATEAUTHORQUERIES = []string{
+	`CREATE TABLE authors (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);`,
+	`CREATE TABLE book_authors (
+		book_id INTEGER NOT NULL,
+		author_id INTEGER NOT NULL,
+		role TEXT NOT NULL DEFAULT 'author',
+		position INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (book_id, author_id, role)
+	);`,
+	`CREATE TRIGGER book_authors_delete AFTER DELETE ON books BEGIN
+		DELETE FROM book_authors WHERE book_id = old.id;
+		DELETE FROM authors WHERE id NOT IN (SELECT author_id FROM book_authors);
+	END;`,
+}
+
+// a person credited on a book
+type credit struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+var AUTHOR_SEPARATOR_RE = regexp.MustCompile(`(?i)\s*(?:&|;|\band\b)\s*`)
+
+// splits "Terry Pratchett & Neil Gaiman" into its names, keeping the first
+// spelling of a name given twice
+func splitAuthors(s string) []string {
+	names, keys := []string{}, []string{}
+	for _, name := range AUTHOR_SEPARATOR_RE.Split(s, -1) {
+		name = strings.TrimSpace(name)
+		key := normaliseName(name)
+		if key != "" && !slices.Contains(keys, key) {
+			names = append(names, name)
+			keys = append(keys, key)
+		}
+	}
+	return names
+}
+
+// the names in s in the form books.author stores them
+func joinAuthors(s string) string {
+	return strings.Join(splitAuthors(s), " & ")
+}
+
+// replaces the people with role on a book, then updates books.author if the
+// authors changed. people are matched on name_key so "neil gaiman" is credited
+// as the existing "Neil Gaiman"
+func setBookCredits(db execer, bookID int64, role string, names []string) error {
+	if _, err := db.Exec("DELETE FROM book_authors WHERE book_id = ? AND role = ?", bookID, role); err != nil {
+		return err
+	}
+	for ix, name := range names {
+		const INSERT = `INSERT INTO authors (name, name_key) SELECT ?, ?
+			WHERE NOT EXISTS (SELECT 1 FROM authors WHERE name_key = ?)`
+		key := normaliseName(name)
+		if _, err := db.Exec(INSERT, name, key, key); err != nil {
+			return err
+		}
+		const QUERY = `INSERT INTO book_authors (book_id, author_id, role, position)
+			SELECT ?, MIN(id), ?, ? FROM authors WHERE name_key = ?`
+		if _, err := db.Exec(QUERY, bookID, role, ix, key); err != nil {
+			return err
+		}
+	}
+	if _, err := db.Exec("DELETE FROM authors WHERE id NOT IN (SELECT author_id FROM book_authors)"); err != nil {
+		return err
+	}
+	if role != "author" {
+		return nil
+	}
+	return refreshBookAuthor(db, "id = ?", bookID)
+}
+
+// rebuilds books.author from book_authors for the books matching where
+func refreshBookAuthor(db execer, where string, args ...any) error {
+	_, err := db.Exec(`UPDATE books SET (author, author_key) = (
+			SELECT COALESCE(group_concat(name, ' & '), ''), COALESCE(group_concat(name_key, ' '), '') FROM (
+				SELECT a.name, a.name_key FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+				WHERE ba.book_id = books.id AND ba.role = 'author' ORDER BY ba.position
+			)
+		) WHERE `+where, args...)
+	return err
+}
+
+// sets every role that has a flag set on c, the authors come from author
+// unless it is empty
+func setCreditsFromFlags(db execer, c *cli.Command, bookID int64, author string) error {
+	if author != "" {
+		if err := setBookCredits(db, bookID, "author", splitAuthors(author)); err != nil {
+			return err
+		}
+	}
+	for _, role := range AUTHOR_ROLES[1:] {
+		if c.IsSet(role) {
+			if err := setBookCredits(db, bookID, role, splitAuthors(c.String(role))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func bookCredits(db *sql.DB, bookID int64) ([]credit, error) {
+	const QUERY = `SELECT a.name, ba.role FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = ? ORDER BY ba.role != 'author', ba.role, ba.position`
+	rows, err := db.Query(QUERY, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []credit{}
+	for rows.Next() {
+		var cr credit
+		if err := rows.Scan(&cr.Name, &cr.Role); err != nil {
+			return nil, err
+		}
+		credits = append(credits, cr)
+	}
+	return credits, rows.Err()
+}
+
+// sql matching books credited to someone whose name matches the LIKE pattern
+const AUTHOR_MATCH = "id IN (SELECT ba.book_id FROM book_authors ba JOIN authors a ON a.id = ba.author_id WHERE ba.role = 'author' AND a.name_key LIKE ?)"
+
+type authorInfo struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func allAuthors(db *sql.DB) ([]authorInfo, error) {
+	rows, err := db.Query("SELECT id, name FROM authors ORDER BY name_key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []authorInfo{}
+	for rows.Next() {
+		var a authorInfo
+		if err := rows.Scan(&a.ID, &a.Name); err != nil {
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
+
+// finds an author by name, loosely like books are found
+func resolveAuthor(db *sql.DB, name string) (authorInfo, error) {
+	if name == "" {
+		return authorInfo{}, errors.New("an author name must be provided")
+	}
+	all, err := allAuthors(db)
+	if err != nil {
+		return authorInfo{}, err
+	}
+
+	query := normaliseName(name)
+	matches := []authorInfo{}
+	for _, a := range all {
+		score, ok := matchScore(query, normaliseName(a.Name))
+		if score == 0 && ok {
+			return a, nil
+		}
+		if ok {
+			matches = append(matches, a)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return authorInfo{}, fmt.Errorf("author '%s' does not exist", name)
+	case 1:
+		return matches[0], nil
+	default:
+		names := []string{}
+		for _, a := range matches {
+			names = append(names, a.Name)
+		}
+		return authorInfo{}, fmt.Errorf("'%s' matches more than one author: '%s'", name, strings.Join(names, "' '"))
+	}
+}
+
+// the ids of the books an author is credited on
+const AUTHOR_BOOKS = "id IN (SELECT book_id FROM book_authors WHERE author_id = ?)"
+
+var authorCmd = &cli.Command{
+	Name:  "author",
+	Usage: "see and tidy up the people credited on books",
+	Commands: []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "list every author, translator, illustrator and narrator",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				authors, err := allAuthors(db)
+				if err != nil {
+					return err
+				}
+				for _, a := range authors {
+					fmt.Println(a.Name)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "show",
+			Usage:     "show the books someone is credited on, by role",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Flags:     []cli.Flag{formatFlag},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				cfg := ctx.Value(configCtx{}).(config)
+				author, err := resolveAuthor(db, c.StringArg("name"))
+				if err != nil {
+					return err
+				}
+
+				byRole := map[string][]Book{}
+				for _, role := range AUTHOR_ROLES {
+					filter := bookFilter{}
+					filter.add("id IN (SELECT book_id FROM book_authors WHERE author_id = ? AND role = ?)", author.ID, role)
+					books, err := queryBooks(db, filter)
+					if err != nil {
+						return err
+					}
+					if len(books) > 0 {
+						byRole[role] = books
+					}
+				}
+
+				if outputFormat(c, cfg) == "json" {
+					return printJSON(struct {
+						authorInfo
+						Books map[string][]Book `json:"books"`
+					}{author, byRole})
+				}
+				fmt.Println(author.Name)
+				for _, role := range AUTHOR_ROLES {
+					if len(byRole[role]) == 0 {
+						continue
+					}
+					fmt.Printf("  as %s:\n", role)
+					for _, book := range byRole[role] {
+						fmt.Printf("  %4d: %s (%s)\n", book.ID, book.Title, book.Status)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "rename",
+			Usage: "fix the name of an author on every book",
+			Arguments: []cli.Argument{
+				&cli.StringArg{Name: "name"},
+				&cli.StringArg{Name: "new-name"},
+			},
+			ArgsUsage: "NAME NEW-NAME",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				author, err := resolveAuthor(db, c.StringArg("name"))
+				if err != nil {
+					return err
+				}
+				newName := strings.TrimSpace(c.StringArg("new-name"))
+				if normaliseName(newName) == "" {
+					return errors.New("a new name must be provided")
+				}
+				var exists int
+				if err := db.QueryRow("SELECT COUNT(*) FROM authors WHERE name_key = ? AND id != ?", normaliseName(newName), author.ID).Scan(&exists); err != nil {
+					return err
+				}
+				if exists != 0 {
+					return fmt.Errorf("author '%s' already exists, use `author merge` to combine them", newName)
+				}
+
+				return execAll(db,
+					execStmt("UPDATE authors SET name = ?, name_key = ? WHERE id = ?", newName, normaliseName(newName), author.ID),
+					func(tx *sql.Tx) error { return refreshBookAuthor(tx, AUTHOR_BOOKS, author.ID) },
+				)
+			},
+		},
+		{
+			Name:  "merge",
+			Usage: "merge an author into another, for when one person was entered twice",
+			Arguments: []cli.Argument{
+				&cli.StringArg{Name: "name"},
+				&cli.StringArg{Name: "into"},
+			},
+			ArgsUsage: "NAME INTO",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				from, err := resolveAuthor(db, c.StringArg("name"))
+				if err != nil {
+					return err
+				}
+				into, err := resolveAuthor(db, c.StringArg("into"))
+				if err != nil {
+					return err
+				}
+				if from.ID == into.ID {
+					return fmt.Errorf("'%s' and '%s' are the same author", c.StringArg("name"), c.StringArg("into"))
+				}
+
+				return execAll(db,
+					execStmt(`INSERT OR IGNORE INTO book_authors (book_id, author_id, role, position)
+						SELECT book_id, ?, role, position FROM book_authors WHERE author_id = ?`, into.ID, from.ID),
+					execStmt("DELETE FROM book_authors WHERE author_id = ?", from.ID),
+					execStmt("DELETE FROM authors WHERE id = ?", from.ID),
+					func(tx *sql.Tx) error { return refreshBookAuthor(tx, AUTHOR_BOOKS, into.ID) },
+				)
+			},
+		},
+	},
+}
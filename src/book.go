@@ -4,9 +4,6 @@ import (
 	"fmt"
 	"strings"
 	"time"
-
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 )
 
 type BookState byte
@@ -23,6 +20,29 @@ func (s BookState) String() string {
 	return [...]string{"NONE", "READING", "FINISHED", "TBR", "DNF"}[s]
 }
 
+func parseBookState(s string) (BookState, error) {
+	switch strings.ToLower(s) {
+	case "none":
+		return BS_NONE, nil
+	case "reading":
+		return BS_READING, nil
+	case "finished":
+		return BS_FINISHED, nil
+	case "tbr":
+		return BS_TBR, nil
+	case "dnf":
+		return BS_DNF, nil
+	default:
+		return BS_NONE, fmt.Errorf(
+			"'%s' is not a valid state for a book, state must be one of 'none' 'reading' 'finished' 'tbr' 'dnf'",
+			s)
+	}
+}
+
+func (s BookState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 func (s BookState) Emoji() string {
 	return [...]string{
 		"NONE",
@@ -34,22 +54,78 @@ func (s BookState) Emoji() string {
 }
 
 type Book struct {
-	ISBN     string
-	Author   string
-	Title    string
-	Series   string
-	Started  time.Time
-	Finished time.Time
-	Status   BookState
-	Genres   []string
-	Took     time.Duration
+	ID   int64  `json:"id"`
+	ISBN string `json:"isbn,omitempty"`
+	// the isbn as it was entered, ISBN is always the canonical ISBN-13
+	ISBNOriginal string `json:"isbn_original,omitempty"`
+	Author       string `json:"author"`
+	Title        string `json:"title"`
+	Series       string `json:"series,omitempty"`
+	// the books place in its series, 0 if it is not known. novellas between
+	// books are fractions like 2.5
+	SeriesPosition float64       `json:"series_position,omitempty"`
+	Started        time.Time     `json:"started,omitzero"`
+	Finished       time.Time     `json:"finished,omitzero"`
+	Status         BookState     `json:"status"`
+	Genres         []string      `json:"genres,omitempty"`
+	Took           time.Duration `json:"-"`
+	// the directory holding the cover variants, relative to the data directory
+	CoverPath string `json:"cover_path,omitempty"`
+	// out of 5, 0 if it has not been rated
+	Rating int    `json:"rating,omitempty"`
+	Review string `json:"review,omitempty"`
+	// 0 if it is not known
+	Pages int `json:"pages,omitempty"`
 }
 
-// make sure to reset b4 using
-var CASER = cases.Title(language.Und)
+// how long a book took to read. a book being read has taken until now so far,
+// a book that was never started or has no finish date took nothing
+func bookTook(status BookState, started, finished, now time.Time) time.Duration {
+	if started.IsZero() {
+		return 0
+	}
+	var took time.Duration
+	switch status {
+	case BS_READING:
+		took = wallClockSub(now, started)
+	case BS_FINISHED, BS_DNF:
+		if finished.IsZero() {
+			return 0
+		}
+		took = wallClockSub(finished, started)
+	}
+	return max(took, 0)
+}
+
+// d in weeks and days, like "3 weeks 2 days"
+func humanDuration(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	if days == 0 {
+		return "less than a day"
+	}
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	weeks, days := days/7, days%7
+	switch {
+	case weeks == 0:
+		return plural(days, "day")
+	case days == 0:
+		return plural(weeks, "week")
+	default:
+		return plural(weeks, "week") + " " + plural(days, "day")
+	}
+}
 
 func (b *Book) String() string {
-	CASER.Reset()
+	return b.Format(time.DateTime)
+}
+
+// dateFormat is the go time layout used for started and finished
+func (b *Book) Format(dateFormat string) string {
 	var sb strings.Builder
 	zeroTime := time.Time{}
 
@@ -61,79 +137,37 @@ func (b *Book) String() string {
 	// started finished took
 	// isbn
 
-	fmt.Fprintf(&sb, "Title   : %s\n", CASER.String(b.Title))
-	CASER.Reset()
-
-	fmt.Fprintf(&sb, "Series  : %s\n", CASER.String(b.Series))
-	CASER.Reset()
+	fmt.Fprintf(&sb, "Title   : %s\n", b.Title)
 
-	fmt.Fprintf(&sb, "Author  : %s\n", CASER.String(b.Author))
-	CASER.Reset()
+	seriesStr := b.Series
+	if b.SeriesPosition != 0 {
+		seriesStr += " #" + formatPosition(b.SeriesPosition)
+	}
+	fmt.Fprintf(&sb, "Series  : %s\n", seriesStr)
+	fmt.Fprintf(&sb, "Author  : %s\n", b.Author)
 
 	fmt.Fprintf(&sb, "Status  : %s\n", b.Status) // emoji
-	fmt.Fprintf(&sb, "Genres  : %s", strings.Join(b.Genres, ", "))
+	fmt.Fprintf(&sb, "Genres  : %s\n", strings.Join(b.Genres, ", "))
 
-	// TODO: need to convert to local time
-	startedStr := b.Started.String()
+	startedStr := b.Started.In(time.Local).Format(dateFormat)
 	if b.Started.Equal(zeroTime) {
 		startedStr = "--"
 	}
 	fmt.Fprintf(&sb, "Started : %s\n", startedStr)
 
-	finishedStr := b.Finished.String()
+	finishedStr := b.Finished.In(time.Local).Format(dateFormat)
 	if b.Finished.Equal(zeroTime) {
 		finishedStr = "--"
 	}
 	fmt.Fprintf(&sb, "Finished: %s\n", finishedStr)
 
-	fmt.Fprintf(&sb, "Took    : %s\n", b.Took)
+	tookStr := humanDuration(b.Took)
+	if b.Took == 0 {
+		tookStr = "--"
+	} else if b.Status == BS_READING {
+		tookStr += " so far"
+	}
+	fmt.Fprintf(&sb, "Took    : %s\n", tookStr)
 	fmt.Fprintf(&sb, "ISBN    : %s\n", b.ISBN)
 	return sb.String()
 }
-
-func cleanISBN(isbn string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(isbn, "-", ""), " ", "")
-}
-
-func validISBN(isbn string) bool {
-	if len(isbn) < 10 {
-		return false
-	}
-	data := make([]int, 0, 13)
-	for _, i := range isbn {
-		if (i >= '0' && i <= '9') || (i == 'x' || i == 'X') {
-			if i == 'x' || i == 'X' {
-				data = append(data, 10)
-			} else {
-				data = append(data, int(i-'0'))
-			}
-		}
-	}
-	return validate10(data) || validate13(data)
-}
-
-func validate10(isbn []int) bool {
-	if len(isbn) != 10 {
-		return false
-	}
-	sum := 0
-	for ix, i := range isbn {
-		sum += (10 - ix) * i
-	}
-	return sum%11 == 0
-}
-
-func validate13(isbn []int) bool {
-	if len(isbn) != 13 {
-		return false
-	}
-	sum := 0
-	for ix, i := range isbn {
-		if ix%2 == 0 {
-			sum += i
-		} else {
-			sum += 3 * i
-		}
-	}
-	return sum%10 == 0
-}
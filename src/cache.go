@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+const CACHE_TTL = 30 * 24 * time.Hour
+
+const CREATECACHEQUERY = `CREATE TABLE IF NOT EXISTS cache (
+	provider TEXT NOT NULL,
+	key TEXT NOT NULL,
+	url TEXT NOT NULL,
+	body BLOB NOT NULL,
+	fetched_at INTEGER NOT NULL,
+	ttl INTEGER NOT NULL,
+	PRIMARY KEY (provider, key)
+);`
+
+type cacheEntry struct {
+	provider  string
+	key       string
+	url       string
+	body      []byte
+	fetchedAt time.Time
+	ttl       time.Duration
+}
+
+func (e *cacheEntry) fresh() bool {
+	return time.Since(e.fetchedAt) < e.ttl
+}
+
+// returns nil if there is no entry
+func cacheGet(db *sql.DB, provider, key string) (*cacheEntry, error) {
+	const QUERY = "SELECT url, body, fetched_at, ttl FROM cache WHERE provider = ? AND key = ?"
+	row := db.QueryRow(QUERY, provider, key)
+
+	entry := cacheEntry{provider: provider, key: key}
+	var fetchedAt, ttl int64
+	err := row.Scan(&entry.url, &entry.body, &fetchedAt, &ttl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entry.fetchedAt = time.Unix(fetchedAt, 0)
+	entry.ttl = time.Duration(ttl) * time.Second
+	return &entry, nil
+}
+
+func cachePut(db *sql.DB, provider, key, url string, body []byte) error {
+	const QUERY = `INSERT INTO cache (provider, key, url, body, fetched_at, ttl) VALUES(?, ?, ?, ?, ?, ?)
+		ON CONFLICT (provider, key) DO UPDATE SET url = excluded.url, body = excluded.body,
+		fetched_at = excluded.fetched_at, ttl = excluded.ttl`
+	_, err := db.Exec(QUERY, provider, key, url, body, time.Now().Unix(), int64(CACHE_TTL/time.Second))
+	return err
+}
+
+// returns the response for url, using the cache when the entry is still fresh.
+// if offline is set the network is never touched, and stale entries are used
+// if the network request fails
+func fetchCached(db *sql.DB, offline bool, provider, key, url string) ([]byte, error) {
+	entry, err := cacheGet(db, provider, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if offline {
+		if entry == nil {
+			return nil, fmt.Errorf("'%s' is not in the %s cache and --offline is set", key, provider)
+		}
+		return entry.body, nil
+	}
+
+	if entry != nil && entry.fresh() {
+		return entry.body, nil
+	}
+
+	body, err := httpGet(url)
+	if err != nil {
+		if entry != nil {
+			fmt.Fprintf(os.Stderr, "WARN: %s, using cached response from %s\n", err, entry.fetchedAt.Format(time.DateOnly))
+			return entry.body, nil
+		}
+		return nil, err
+	}
+
+	if err := cachePut(db, provider, key, url, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func allCacheEntries(db *sql.DB) ([]cacheEntry, error) {
+	const QUERY = "SELECT provider, key, url, body, fetched_at, ttl FROM cache ORDER BY provider, key"
+	rows, err := db.Query(QUERY)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []cacheEntry{}
+	for rows.Next() {
+		var entry cacheEntry
+		var fetchedAt, ttl int64
+		err := rows.Scan(&entry.provider, &entry.key, &entry.url, &entry.body, &fetchedAt, &ttl)
+		if err != nil {
+			return nil, err
+		}
+		entry.fetchedAt = time.Unix(fetchedAt, 0)
+		entry.ttl = time.Duration(ttl) * time.Second
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+var cacheCmd = &cli.Command{
+	Name:  "cache",
+	Usage: "inspect and manage the local metadata cache",
+	Commands: []*cli.Command{
+		{
+			Name:  "stats",
+			Usage: "show how many lookups are cached",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+
+				entries, err := allCacheEntries(db)
+				if err != nil {
+					return err
+				}
+				if len(entries) == 0 {
+					fmt.Println("the cache is empty")
+					return nil
+				}
+
+				type stats struct {
+					total, stale, size int
+					oldest, newest     time.Time
+				}
+				byProvider := map[string]*stats{}
+				order := []string{}
+				for _, entry := range entries {
+					s, ok := byProvider[entry.provider]
+					if !ok {
+						s = &stats{oldest: entry.fetchedAt, newest: entry.fetchedAt}
+						byProvider[entry.provider] = s
+						order = append(order, entry.provider)
+					}
+					s.total++
+					s.size += len(entry.body)
+					if !entry.fresh() {
+						s.stale++
+					}
+					if entry.fetchedAt.Before(s.oldest) {
+						s.oldest = entry.fetchedAt
+					}
+					if entry.fetchedAt.After(s.newest) {
+						s.newest = entry.fetchedAt
+					}
+				}
+
+				for _, name := range order {
+					s := byProvider[name]
+					fmt.Printf("%s:\n", name)
+					fmt.Printf("  entries: %d (%d stale)\n", s.total, s.stale)
+					fmt.Printf("  size   : %d bytes\n", s.size)
+					fmt.Printf("  oldest : %s\n", s.oldest.Format(time.DateTime))
+					fmt.Printf("  newest : %s\n", s.newest.Format(time.DateTime))
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "clear",
+			Usage: "remove cached lookups",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "stale",
+					Usage: "only remove entries that are past their ttl",
+				},
+				&cli.StringFlag{
+					Name:  "provider",
+					Usage: "only remove entries from `provider`",
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+
+				query := "DELETE FROM cache WHERE 1 = 1"
+				args := []any{}
+				if c.Bool("stale") {
+					query += " AND fetched_at + ttl <= ?"
+					args = append(args, time.Now().Unix())
+				}
+				if c.IsSet("provider") {
+					query += " AND provider = ?"
+					args = append(args, c.String("provider"))
+				}
+
+				res, err := db.Exec(query, args...)
+				if err != nil {
+					return err
+				}
+				n, err := res.RowsAffected()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("removed %d cache entries\n", n)
+				return nil
+			},
+		},
+		{
+			Name:  "refresh",
+			Usage: "re-fetch stale cached lookups",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "re-fetch every entry, not just the stale ones",
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				if c.Bool("offline") {
+					return errors.New("can not refresh the cache with --offline set")
+				}
+				db := ctx.Value(myCtx{}).(*sql.DB)
+
+				entries, err := allCacheEntries(db)
+				if err != nil {
+					return err
+				}
+
+				refreshed, failed := 0, 0
+				for _, entry := range entries {
+					if entry.fresh() && !c.Bool("all") {
+						continue
+					}
+					body, err := httpGet(entry.url)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "WARN: could not refresh '%s': %s\n", entry.key, err)
+						failed++
+						continue
+					}
+					if err := cachePut(db, entry.provider, entry.key, entry.url, body); err != nil {
+						return err
+					}
+					refreshed++
+				}
+
+				fmt.Printf("refreshed %d cache entries", refreshed)
+				if failed > 0 {
+					fmt.Printf(", %d failed", failed)
+				}
+				fmt.Println()
+				return nil
+			},
+		},
+	},
+}
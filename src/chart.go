@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// the widest a bar can be, in full blocks
+const BAR_WIDTH = 40
+
+// how many genres the genre chart shows
+const CHART_GENRES = 10
+
+// bars are full blocks with an eighth block for the remainder
+var BAR_EIGHTHS = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// heatmap levels by how many books were read that day, 4 or more is the
+// last level. with colour every cell is a square in github's greens from the
+// 256 colour palette, without it the shade shows the level
+var (
+	HEAT_COLOURS = []string{"\x1b[38;5;238m", "\x1b[38;5;22m", "\x1b[38;5;28m", "\x1b[38;5;34m", "\x1b[38;5;46m"}
+	HEAT_SHADES  = []string{"·", "░", "▒", "▓", "█"}
+)
+
+const (
+	HEAT_CELL    = "■"
+	BAR_COLOUR   = "\x1b[32m"
+	RESET_COLOUR = "\x1b[0m"
+)
+
+// a bar width eighths of a block long for value out of most
+func bar(value, most int) string {
+	if most == 0 {
+		return ""
+	}
+	eighths := value * BAR_WIDTH * 8 / most
+	if value > 0 && eighths == 0 {
+		eighths = 1
+	}
+	return strings.Repeat("█", eighths/8) + BAR_EIGHTHS[eighths%8]
+}
+
+func barChart(title string, rows []statsCount, colour bool) string {
+	var sb strings.Builder
+	sb.WriteString(title + "\n")
+	width, most := 0, 0
+	for _, row := range rows {
+		width = max(width, len(row.Name))
+		most = max(most, row.Count)
+	}
+	if most == 0 {
+		sb.WriteString("  nothing yet\n")
+		return sb.String()
+	}
+	for _, row := range rows {
+		b := bar(row.Count, most)
+		if colour && b != "" {
+			b = BAR_COLOUR + b + RESET_COLOUR
+		}
+		fmt.Fprintf(&sb, "  %-*s  %s %d\n", width, row.Name, b, row.Count)
+	}
+	return sb.String()
+}
+
+// marks the days each book was being read in days, which are keyed by
+// 2006-01-02 then book id. a book is being read from the day it was started
+// to the day it was finished, or to now if it is still being read
+func addSpanDays(days map[string]map[int64]bool, books []Book, now time.Time) {
+	for _, book := range books {
+		if book.Started.IsZero() {
+			continue
+		}
+		end := book.Finished
+		switch book.Status {
+		case BS_READING:
+			end = now
+		case BS_FINISHED, BS_DNF:
+			if end.IsZero() {
+				continue
+			}
+		default:
+			continue
+		}
+		last := midnight(end.In(time.Local))
+		for day := midnight(book.Started.In(time.Local)); !day.After(last); day = day.AddDate(0, 0, 1) {
+			markDay(days, day.Format(time.DateOnly), book.ID)
+		}
+	}
+}
+
+func markDay(days map[string]map[int64]bool, day string, id int64) {
+	if days[day] == nil {
+		days[day] = map[int64]bool{}
+	}
+	days[day][id] = true
+}
+
+// how many books were read on each day
+func dayCounts(days map[string]map[int64]bool) map[string]int {
+	counts := map[string]int{}
+	for day, books := range days {
+		counts[day] = len(books)
+	}
+	return counts
+}
+
+func heatCell(count int, colour bool) string {
+	level := min(count, len(HEAT_SHADES)-1)
+	if colour {
+		return HEAT_COLOURS[level] + HEAT_CELL + RESET_COLOUR
+	}
+	return HEAT_SHADES[level]
+}
+
+// a github style calendar of year, a column per week and a row per weekday
+// starting on monday. days after now are left blank
+func heatmap(year int, counts map[string]int, now time.Time, colour bool) string {
+	first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+	next := first.AddDate(1, 0, 0)
+	// back to the monday of the first week
+	start := first.AddDate(0, 0, -((int(first.Weekday()) + 6) % 7))
+
+	weeks := 0
+	for day := start; day.Before(next); day = day.AddDate(0, 0, 7) {
+		weeks++
+	}
+
+	// month names above the week they start in, if there is room
+	labels := []byte(strings.Repeat(" ", weeks+3))
+	for month := time.January; month <= time.December; month++ {
+		day := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+		week := int(day.Sub(start).Hours()/24) / 7
+		name := day.Format("Jan")
+		if strings.TrimSpace(string(labels[max(0, week-1):week+len(name)])) == "" {
+			copy(labels[week:], name)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "     %s\n", strings.TrimRight(string(labels), " "))
+	reading := 0
+	for weekday := range 7 {
+		label := ""
+		if weekday%2 == 0 {
+			label = start.AddDate(0, 0, weekday).Format("Mon")
+		}
+		fmt.Fprintf(&sb, "%-3s  ", label)
+		for week := range weeks {
+			day := start.AddDate(0, 0, week*7+weekday)
+			if day.Before(first) || !day.Before(next) || day.After(now) {
+				sb.WriteString(" ")
+				continue
+			}
+			count := counts[day.Format(time.DateOnly)]
+			if count > 0 {
+				reading++
+			}
+			sb.WriteString(heatCell(count, colour))
+		}
+		sb.WriteString("\n")
+	}
+
+	legend := []string{}
+	for level := range HEAT_SHADES {
+		legend = append(legend, heatCell(level, colour))
+	}
+	fmt.Fprintf(&sb, "     less %s more, %d reading days\n", strings.Join(legend, " "), reading)
+	return sb.String()
+}
+
+var chartCmd = &cli.Command{
+	Name:  "chart",
+	Usage: "charts of the books finished each month, genres and a calendar of reading days",
+	Description: "the calendar shows the days in the reading log, see `log`. with --spans, or streak_spans in\n" +
+		"the config, every day between starting a book and finishing it is shown too",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:        "year",
+			Usage:       "the `year` to chart",
+			DefaultText: "this year",
+		},
+		&cli.BoolFlag{
+			Name:        "spans",
+			Usage:       "also show the days between starting and finishing a book",
+			DefaultText: "streak_spans from config",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		db := ctx.Value(myCtx{}).(*sql.DB)
+		cfg := ctx.Value(configCtx{}).(config)
+		now := time.Now()
+		year := int(c.Int("year"))
+		if year == 0 {
+			year = now.Year()
+		}
+		colour := useColour()
+
+		finished, err := statsBooks(db, year)
+		if err != nil {
+			return err
+		}
+		stats := computeStats(finished, year)
+		months := []statsCount{}
+		for _, month := range stats.ByMonth {
+			t, _ := time.Parse("2006-01", month.Name)
+			months = append(months, statsCount{t.Format("Jan"), month.Count})
+		}
+		genres := map[string]int{}
+		for _, book := range finished {
+			if book.Status == BS_FINISHED {
+				for _, genre := range book.Genres {
+					genres[genre]++
+				}
+			}
+		}
+
+		spans := cfg.defaults.streakSpans
+		if c.IsSet("spans") {
+			spans = c.Bool("spans")
+		}
+		days, err := readingDays(db, cfg.defaults.streakStates, spans, now)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(barChart(fmt.Sprintf("Books finished per month, %d", year), months, colour))
+		fmt.Println()
+		fmt.Print(barChart(fmt.Sprintf("Genres, %d", year), topCounts(genres, CHART_GENRES), colour))
+		fmt.Println()
+		fmt.Printf("Reading days, %d\n", year)
+		fmt.Print(heatmap(year, dayCounts(days), now, colour))
+		return nil
+	},
+}
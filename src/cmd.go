@@ -6,11 +6,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"math"
-	"net/http"
+	"os"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/urfave/cli/v3"
 )
@@ -29,13 +28,14 @@ func DefaultAction(_ context.Context, c *cli.Command) error {
 func requireAuthorTitleOrISBN(c *cli.Command) error {
 	title, author := c.StringArg("title"), c.StringArg("author")
 	if c.Bool("ISBN") {
-		if validISBN(title) {
+		_, err := parseISBN(title)
+		if err == nil {
 			return nil
 		}
 		if author != "" {
 			return errors.New("author must not be set if using ISBN mode")
 		}
-		return fmt.Errorf("'%s' is not a valid ISBN number", title)
+		return err
 	}
 	authorNotSet, titleNotSet := author == "", title == ""
 	if authorNotSet && titleNotSet {
@@ -50,6 +50,7 @@ func requireAuthorTitleOrISBN(c *cli.Command) error {
 
 // returns isbnSet, title, author, isbn, error in that order
 // It zeros title and author if ISBN is set
+// isbn is returned in its canonical ISBN-13 form
 func determineTitleAuthorISBNAndISBNisSet(c *cli.Command) (bool, string, string, string, error) {
 	isbnSet := c.IsSet("ISBN")
 	title, author := c.StringArg("title"), c.StringArg("author")
@@ -63,35 +64,55 @@ func determineTitleAuthorISBNAndISBNisSet(c *cli.Command) (bool, string, string,
 		}
 
 		if !c.IsSet("isbn") {
-			return isbnSet, title, author, cleanISBN(title), nil
+			return isbnSet, title, author, canonicalISBN(title), nil
 		}
 
 		localISBN := c.String("isbn")
-		if cleanISBN(title) != cleanISBN(localISBN) {
+		if canonicalISBN(title) != canonicalISBN(localISBN) {
 			return false, "", "", "", fmt.Errorf(
 				"isbn was set twice and they do not match: ISBN = '%s' isbn = '%s'",
 				title, localISBN)
 		}
 	}
 
-	if c.IsSet("isbn") && !validISBN(c.String("isbn")) {
-		return false, "", "", "", fmt.Errorf("'%s' is not a valid ISBN number", c.String("isbn"))
+	return false, title, author, canonicalISBN(c.String("isbn")), nil
+}
+
+// --format if it is set, otherwise the configured default
+func outputFormat(c *cli.Command, cfg config) string {
+	if c.IsSet("format") {
+		return c.String("format")
+	}
+	return cfg.defaults.outputFormat
+}
 
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
 	}
-	return false, title, author, cleanISBN(c.String("isbn")), nil
+	fmt.Println(string(data))
+	return nil
 }
 
 func validStateAction(_ context.Context, c *cli.Command, s string) error {
-	switch strings.ToLower(s) {
-	case "none", "reading", "finished", "tbr", "dnf":
-		return nil
-	default:
-		return fmt.Errorf(
-			"'%s' is not a valid state for a book, state must be one of 'none' 'reading' 'finished' 'tbr' 'dnf'",
-			s)
+	_, err := parseBookState(s)
+	return err
+}
+
+// the isbn as it was typed in, with dashes and spaces removed
+func enteredISBN(c *cli.Command) string {
+	if c.IsSet("isbn") {
+		return cleanISBN(c.String("isbn"))
+	}
+	if c.IsSet("ISBN") {
+		return cleanISBN(c.StringArg("title"))
 	}
+	return ""
 }
 
+// matches the canonical isbn, isbn_original is only a record of what was
+// entered
 func isbnExists(db *sql.DB, isbn string, shouldExist bool) error {
 	const QUERY = "SELECT EXISTS(SELECT 1 FROM books WHERE isbn = ?)"
 	row := db.QueryRow(QUERY, isbn)
@@ -116,8 +137,8 @@ func isbnExists(db *sql.DB, isbn string, shouldExist bool) error {
 }
 
 func titleAuthorExists(db *sql.DB, title, author string, shouldExist bool) error {
-	const QUERY = "SELECT EXISTS(SELECT 1 FROM books WHERE title = ? AND author = ?)"
-	row := db.QueryRow(QUERY, strings.ToLower(title), strings.ToLower(author))
+	const QUERY = "SELECT EXISTS(SELECT 1 FROM books WHERE title_key = ? AND author_key = ?)"
+	row := db.QueryRow(QUERY, normaliseName(title), normaliseName(author))
 
 	var exists int
 	err := row.Scan(&exists)
@@ -149,6 +170,10 @@ var (
 		Name:  "isbn",
 		Usage: "the `ISBN` number of the book",
 		Value: "",
+		Action: func(ctx context.Context, c *cli.Command, s string) error {
+			_, err := parseISBN(s)
+			return err
+		},
 	}
 	authorFlag = &cli.StringFlag{
 		Name:    "author",
@@ -178,6 +203,29 @@ var (
 		Usage:   "the name of the `series` the book belongs to",
 		Value:   "",
 	}
+	translatorFlag = &cli.StringFlag{
+		Name:  "translator",
+		Usage: "the `names` of the translators, separated by &",
+	}
+	illustratorFlag = &cli.StringFlag{
+		Name:  "illustrator",
+		Usage: "the `names` of the illustrators, separated by &",
+	}
+	narratorFlag = &cli.StringFlag{
+		Name:  "narrator",
+		Usage: "the `names` of the audiobook narrators, separated by &",
+	}
+	seriesPositionFlag = &cli.FloatFlag{
+		Name:    "series-position",
+		Aliases: []string{"sp"},
+		Usage:   "the books `position` in its series, novellas between books can be fractions like 2.5",
+		Action: func(_ context.Context, _ *cli.Command, f float64) error {
+			if f <= 0 {
+				return fmt.Errorf("'%g' is not a valid series position, it must be more than 0", f)
+			}
+			return nil
+		},
+	}
 	stateFlag = &cli.StringFlag{
 		Name:        "state",
 		Aliases:     []string{"st"},
@@ -186,27 +234,30 @@ var (
 		DefaultText: "none",
 		Action:      validStateAction,
 	}
-	startedFlag = &cli.TimestampFlag{
-		Name:    "started",
-		Aliases: []string{"s"},
-		Usage:   "the `date` you started the book",
-		Value:   time.Now(),
-		Config: cli.TimestampConfig{
-			Timezone: time.Local,
-			Layouts:  []string{"2006-01-02T15:04:05"},
-		},
+	startedFlag = &cli.StringFlag{
+		Name:        "started",
+		Aliases:     []string{"s"},
+		Usage:       "the `date` you started the book, 2006-01-02, 2006-01-02T15:04:05 or 'yesterday', 'last friday', '3 days ago', 'oct 3'",
 		DefaultText: "now",
+		Action:      validDateAction,
 	}
-	finishedFlag = &cli.TimestampFlag{
-		Name:    "finished",
-		Aliases: []string{"f"},
-		Usage:   "the `date` you finished the book",
-		Value:   time.Now(),
-		Config: cli.TimestampConfig{
-			Timezone: time.Local,
-			Layouts:  []string{"2006-01-02T15:04:05"},
-		},
+	finishedFlag = &cli.StringFlag{
+		Name:        "finished",
+		Aliases:     []string{"f"},
+		Usage:       "the `date` you finished the book, 2006-01-02, 2006-01-02T15:04:05 or 'yesterday', 'last friday', '3 days ago', 'oct 3'",
 		DefaultText: "now",
+		Action:      validDateAction,
+	}
+	formatFlag = &cli.StringFlag{
+		Name:        "format",
+		Usage:       "the output `format`, must be one of 'text' 'json'",
+		DefaultText: "from config",
+		Action: func(ctx context.Context, c *cli.Command, s string) error {
+			if s != "text" && s != "json" {
+				return fmt.Errorf("'%s' is not a valid output format, must be one of 'text' 'json'", s)
+			}
+			return nil
+		},
 	}
 	genresFlag = &cli.StringSliceFlag{
 		Name:    "genres",
@@ -214,41 +265,124 @@ var (
 		Usage:   "a list of comma separated genres `genre1,genre2`",
 		Value:   nil,
 	}
+	ratingFlag = &cli.IntFlag{
+		Name:  "rating",
+		Usage: "your `rating` of the book out of 5, 0 removes it",
+		Action: func(_ context.Context, _ *cli.Command, n int) error {
+			if n < 0 || n > 5 {
+				return fmt.Errorf("'%d' is not a valid rating, it must be from 1 to 5, or 0 to remove it", n)
+			}
+			return nil
+		},
+	}
+	pagesFlag = &cli.IntFlag{
+		Name:  "pages",
+		Usage: "how many `pages` the book has, 0 removes it",
+		Action: func(_ context.Context, _ *cli.Command, n int) error {
+			if n < 0 {
+				return fmt.Errorf("'%d' is not a valid page count, it must be 0 or more", n)
+			}
+			return nil
+		},
+	}
+	reviewFlag = &cli.StringFlag{
+		Name:  "review",
+		Usage: "what you thought of the book, an empty `review` removes it",
+	}
+	tookMoreThanFlag = &cli.StringFlag{
+		Name:   "took-more-than",
+		Usage:  "only books that took longer than `duration`, like 30d, 2w or 1w3d",
+		Action: validTookAction,
+	}
+	tookLessThanFlag = &cli.StringFlag{
+		Name:   "took-less-than",
+		Usage:  "only books that took less than `duration`, like 30d, 2w or 1w3d",
+		Action: validTookAction,
+	}
+	whereFlag = &cli.StringFlag{
+		Name:    "where",
+		Aliases: []string{"w"},
+		Usage:   "filter with an `expression` like 'status:finished genre:fantasy finished:2025 -author:sanderson', see the README",
+		Action:  validWhereAction,
+	}
 )
 
 var addFlags = []cli.Flag{
 	isbnFlag,
 	authorFlag,
+	translatorFlag,
+	illustratorFlag,
+	narratorFlag,
 	titleFlag,
 	seriesFlag,
+	seriesPositionFlag,
 	startedFlag,
 	finishedFlag,
 	stateFlag,
 	genresFlag,
+	pagesFlag,
 }
 
 var startFlags = []cli.Flag{
 	isbnFlag,
+	translatorFlag,
+	illustratorFlag,
+	narratorFlag,
 	seriesFlag,
+	seriesPositionFlag,
 	startedFlag,
 	genresFlag,
+	pagesFlag,
+}
+
+// the rating as it is stored, 0 removes it
+func flagRating(c *cli.Command) any {
+	if rating := c.Int("rating"); rating != 0 {
+		return rating
+	}
+	return nil
+}
+
+// the page count as it is stored, 0 is not known
+func storedPages(pages int) any {
+	if pages == 0 {
+		return nil
+	}
+	return pages
+}
+
+// the review as it is stored, an empty review removes it
+func flagReview(c *cli.Command) any {
+	if review := strings.TrimSpace(c.String("review")); review != "" {
+		return review
+	}
+	return nil
 }
 
 var finishFlags = []cli.Flag{
 	isbnFlag,
 	finishedFlag,
 	stateFlag,
+	ratingFlag,
+	reviewFlag,
 }
 
 var updateFlags = []cli.Flag{
 	isbnFlag,
 	seriesFlag,
+	seriesPositionFlag,
 	stateFlag,
 	startedFlag,
 	finishedFlag,
 	genresFlag,
 	authorFlag,
+	translatorFlag,
+	illustratorFlag,
+	narratorFlag,
 	titleFlag,
+	ratingFlag,
+	reviewFlag,
+	pagesFlag,
 }
 
 var listFlags = []cli.Flag{
@@ -260,14 +394,33 @@ var listFlags = []cli.Flag{
 	genresFlag,
 	authorFlag,
 	titleFlag,
+	tookMoreThanFlag,
+	tookLessThanFlag,
+	whereFlag,
 }
 
 // TODO: at the moment we build a Book obj and then write it to the db
 // do we want to maybe just write it to the db straight
 var CMD = &cli.Command{
-	Name:  "bookTracker",
-	Usage: "track your books locally",
+	Name:   "bookTracker",
+	Usage:  "track your books locally",
+	Before: setup,
+	After:  teardown,
 	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "db",
+			Usage:       "the `path` to the database to use",
+			Sources:     cli.EnvVars("BOOKTRACKER_DB"),
+			DefaultText: "db_path from the config file or the data directory",
+			TakesFile:   true,
+		},
+		&cli.StringFlag{
+			Name:        "profile",
+			Aliases:     []string{"p"},
+			Usage:       "the `profile` to use",
+			Sources:     cli.EnvVars("BOOKTRACKER_PROFILE"),
+			DefaultText: "profile from the config file",
+		},
 		&cli.BoolFlag{
 			Name:    "ISBN",
 			Aliases: []string{"I"},
@@ -276,17 +429,35 @@ var CMD = &cli.Command{
 		&cli.BoolFlag{
 			Name:    "lookup",
 			Aliases: []string{"L"},
-			Usage:   "use openlibrary to look up details about a book and add those details to the database",
+			Usage:   "look up details of a book being added, like its page count, with the metadata providers",
+		},
+		&cli.BoolFlag{
+			Name:  "offline",
+			Usage: "only answer lookups from the local cache, never touch the network",
 		},
 	},
 	Commands: []*cli.Command{
 		{
 			Name:      "start",
-			Usage:     "start a book",
+			Usage:     "start a book, either one already in the database or a new one",
 			Arguments: commonArgs,
-			ArgsUsage: "[[title author]|ISBN]",
-			Flags:     startFlags,
+			ArgsUsage: "[[title author]|ISBN|id]",
+			Flags: append(slices.Clone(startFlags), &cli.BoolFlag{
+				Name:  "new",
+				Usage: "always add a new book, even if a similar one already exists",
+			}),
 			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				if !c.Bool("new") {
+					existing, found, err := bookToStart(db, c)
+					if err != nil {
+						return err
+					}
+					if found {
+						return startExisting(db, c, existing)
+					}
+				}
+
 				if err := requireAuthorTitleOrISBN(c); err != nil {
 					return err
 				}
@@ -295,8 +466,8 @@ var CMD = &cli.Command{
 				if err != nil {
 					return err
 				}
+				author = joinAuthors(author)
 
-				db := ctx.Value(myCtx{}).(*sql.DB)
 				// check if the book already exists
 				if isbnSet {
 					if err := isbnExists(db, isbn, false); err != nil {
@@ -308,13 +479,24 @@ var CMD = &cli.Command{
 					}
 				}
 
+				started, err := flagDateEcho(c, "started")
+				if err != nil {
+					return err
+				}
+
 				book := Book{
-					ISBN:    isbn,
-					Author:  strings.ToLower(author),
-					Title:   strings.ToLower(title),
-					Series:  strings.ToLower(c.String("series")),
-					Status:  BS_READING,
-					Started: c.Timestamp("started"),
+					ISBN:           isbn,
+					ISBNOriginal:   enteredISBN(c),
+					Author:         author,
+					Title:          strings.TrimSpace(title),
+					Series:         strings.TrimSpace(c.String("series")),
+					SeriesPosition: c.Float("series-position"),
+					Status:         BS_READING,
+					Started:        started,
+					Pages:          c.Int("pages"),
+				}
+				if book.Pages == 0 && c.Bool("lookup") {
+					book.Pages = lookupPages(db, c, ctx.Value(configCtx{}).(config), book)
 				}
 
 				genres := c.StringSlice("genres")
@@ -325,32 +507,31 @@ var CMD = &cli.Command{
 					book.Genres = genres
 				}
 
-				const QUERY = "INSERT INTO books (isbn, author, title, series, date_started, status, genres) VALUES(?, ?, ?, ?, ?, ?, ?)"
-				_, err = db.Exec(QUERY,
-					book.ISBN, book.Author, book.Title, book.Series,
-					book.Started.Unix(), book.Status, strings.Join(book.Genres, ","))
-				if err != nil {
-					return err
-				}
-				return nil
+				const QUERY = "INSERT INTO books (isbn, isbn_original, author, title, series, series_position, date_started, status, genres, pages, title_key, author_key, series_key) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+				// the book and its credits are added together or not at all
+				return execAll(db, func(tx *sql.Tx) error {
+					res, err := tx.Exec(QUERY,
+						book.ISBN, book.ISBNOriginal, book.Author, book.Title, book.Series, storedPosition(book.SeriesPosition),
+						storedTime(book.Started), book.Status, strings.Join(book.Genres, ","), storedPages(book.Pages),
+						normaliseName(book.Title), normaliseName(book.Author), normaliseName(book.Series))
+					if err != nil {
+						return err
+					}
+					id, err := res.LastInsertId()
+					if err != nil {
+						return err
+					}
+					return setCreditsFromFlags(tx, c, id, book.Author)
+				})
 			},
 		},
 		{
 			Name:      "finish",
 			Usage:     "finish a book that you started",
 			Arguments: commonArgs,
-			ArgsUsage: "[[title author]|ISBN]",
+			ArgsUsage: "[[title author]|ISBN|id]",
 			Flags:     finishFlags,
 			Action: func(ctx context.Context, c *cli.Command) error {
-				if err := requireAuthorTitleOrISBN(c); err != nil {
-					return err
-				}
-
-				isbnSet, title, author, isbn, err := determineTitleAuthorISBNAndISBNisSet(c)
-				if err != nil {
-					return err
-				}
-
 				state := BS_FINISHED
 				if c.IsSet("state") {
 					stateStr := strings.ToLower(c.String("state"))
@@ -365,29 +546,30 @@ var CMD = &cli.Command{
 				}
 
 				db := ctx.Value(myCtx{}).(*sql.DB)
-				// check if the book already exists
-				if isbnSet {
-					if err := isbnExists(db, isbn, true); err != nil {
-						return err
-					}
-
-					const QUERY = "UPDATE books SET status = ?, date_finished = ? WHERE isbn = ?"
-					_, err := db.Exec(QUERY, state, c.Timestamp("finished").Unix(), isbn)
-					if err != nil {
-						return err
-					}
-				} else {
-					if err := titleAuthorExists(db, title, author, true); err != nil {
-						return err
-					}
+				book, err := resolveBookArgs(db, c)
+				if err != nil {
+					return err
+				}
 
-					const QUERY = "UPDATE books SET status = ?, date_finished = ? WHERE title = ? AND author = ?"
-					_, err := db.Exec(QUERY, state, c.Timestamp("finished").Unix(), strings.ToLower(title), strings.ToLower(author))
-					if err != nil {
-						return err
-					}
+				finished, err := flagDateEcho(c, "finished")
+				if err != nil {
+					return err
 				}
 
+				set := "status = ?, date_finished = ?"
+				args := []any{state, storedTime(finished)}
+				if c.IsSet("rating") {
+					set += ", rating = ?"
+					args = append(args, flagRating(c))
+				}
+				if c.IsSet("review") {
+					set += ", review = ?"
+					args = append(args, flagReview(c))
+				}
+				_, err = db.Exec("UPDATE books SET "+set+" WHERE id = ?", append(args, book.ID)...)
+				if err != nil {
+					return err
+				}
 				return nil
 			},
 		},
@@ -402,59 +584,161 @@ var CMD = &cli.Command{
 					return err
 				}
 
-				fmt.Println("TODO: 'add'")
-				fmt.Printf("args: %s\n", c.Args())
-				fmt.Printf("started: %s\n", c.Timestamp("started"))
-				fmt.Printf("genres: %s\n", c.StringSlice("genres"))
-				return nil
+				isbnSet, title, author, isbn, err := determineTitleAuthorISBNAndISBNisSet(c)
+				if err != nil {
+					return err
+				}
+				author = joinAuthors(author)
+
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				cfg := ctx.Value(configCtx{}).(config)
+				// check if the book already exists
+				if isbnSet {
+					if err := isbnExists(db, isbn, false); err != nil {
+						return err
+					}
+				} else {
+					if err := titleAuthorExists(db, title, author, false); err != nil {
+						return err
+					}
+				}
+
+				state := cfg.defaults.state
+				if c.IsSet("state") {
+					state, err = parseBookState(c.String("state"))
+					if err != nil {
+						return err
+					}
+				}
+
+				book := Book{
+					ISBN:           isbn,
+					ISBNOriginal:   enteredISBN(c),
+					Author:         author,
+					Title:          strings.TrimSpace(title),
+					Series:         strings.TrimSpace(c.String("series")),
+					SeriesPosition: c.Float("series-position"),
+					Status:         state,
+					Pages:          c.Int("pages"),
+				}
+				if book.Pages == 0 && c.Bool("lookup") {
+					book.Pages = lookupPages(db, c, cfg, book)
+				}
+				// only fill in dates that make sense for the state
+				if c.IsSet("started") || state == BS_READING || state == BS_FINISHED || state == BS_DNF {
+					if book.Started, err = flagDateEcho(c, "started"); err != nil {
+						return err
+					}
+				}
+				if c.IsSet("finished") || state == BS_FINISHED || state == BS_DNF {
+					if book.Finished, err = flagDateEcho(c, "finished"); err != nil {
+						return err
+					}
+				}
+
+				genres := c.StringSlice("genres")
+				for ix, i := range genres {
+					genres[ix] = strings.ToLower(i)
+				}
+				book.Genres = genres
+
+				const QUERY = "INSERT INTO books (isbn, isbn_original, author, title, series, series_position, date_started, date_finished, status, genres, pages, title_key, author_key, series_key) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+				// the book and its credits are added together or not at all
+				return execAll(db, func(tx *sql.Tx) error {
+					res, err := tx.Exec(QUERY,
+						book.ISBN, book.ISBNOriginal, book.Author, book.Title, book.Series, storedPosition(book.SeriesPosition),
+						storedTime(book.Started), storedTime(book.Finished), book.Status, strings.Join(book.Genres, ","), storedPages(book.Pages),
+						normaliseName(book.Title), normaliseName(book.Author), normaliseName(book.Series))
+					if err != nil {
+						return err
+					}
+					id, err := res.LastInsertId()
+					if err != nil {
+						return err
+					}
+					return setCreditsFromFlags(tx, c, id, book.Author)
+				})
 			},
 		},
 		{
 			// add toggle for fine grain times
 			Name:  "list",
 			Usage: "list out all of the books in the database",
-			Flags: listFlags,
+			Flags: append(slices.Clone(listFlags), formatFlag,
+				&cli.BoolFlag{
+					Name:  "all-profiles",
+					Usage: "list the books in every profile",
+				},
+				&cli.StringFlag{
+					Name:  "sort",
+					Usage: "sort by `key`, must be one of 'id' 'title' 'author' 'series' 'started' 'finished' 'took'",
+					Value: "id",
+					Action: func(_ context.Context, _ *cli.Command, s string) error {
+						_, err := bookCompare(s)
+						return err
+					},
+				},
+				&cli.BoolFlag{
+					Name:    "reverse",
+					Aliases: []string{"r"},
+					Usage:   "reverse the sort order",
+				},
+				&cli.StringFlag{
+					Name:  "shelf",
+					Usage: "only books on the shelf called `name`, see `shelf save`",
+				},
+			),
 			Action: func(ctx context.Context, c *cli.Command) error {
 				db := ctx.Value(myCtx{}).(*sql.DB)
+				cfg := ctx.Value(configCtx{}).(config)
 
-				const QUERY = "SELECT * FROM books"
-				rows, err := db.Query(QUERY)
+				filter, err := filterFromFlags(c)
 				if err != nil {
 					return err
 				}
-				defer rows.Close()
+				if c.IsSet("shelf") {
+					if err := addShelfFilter(db, &filter, c.String("shelf")); err != nil {
+						return err
+					}
+				}
+				compare, err := bookCompare(c.String("sort"))
+				if err != nil {
+					return err
+				}
+				if c.Bool("reverse") {
+					forward := compare
+					compare = func(a, b Book) int { return forward(b, a) }
+				}
 
-				for rows.Next() {
-					var id, status int
-					var date_started, date_finished sql.NullInt64
-					var isbn, title, author, series, genres string
-					err = rows.Scan(&id, &isbn, &author, &title, &series, &date_started, &date_finished, &status, &genres)
+				if c.Bool("all-profiles") {
+					books, err := queryAllProfiles(c, db, cfg, filter)
 					if err != nil {
 						return err
 					}
-
-					started := time.Time{}
-					if date_started.Valid {
-						started = time.Unix(date_started.Int64, 0).Local()
+					slices.SortStableFunc(books, func(a, b profileBook) int { return compare(a.Book, b.Book) })
+					if outputFormat(c, cfg) == "json" {
+						return printJSON(books)
 					}
-					finished := time.Time{}
-					if date_finished.Valid {
-						finished = time.Unix(date_finished.Int64, 0).Local()
+					for _, book := range books {
+						fmt.Printf("Profile : %s\n", book.Profile)
+						fmt.Println(book.Format(cfg.defaults.dateFormat))
+						fmt.Println()
 					}
+					return nil
+				}
 
-					book := Book{
-						ISBN:     isbn,
-						Author:   author,
-						Title:    title,
-						Series:   series,
-						Started:  started,
-						Finished: finished,
-						Status:   BookState(status),
-						Genres:   strings.Split(genres, ","),
-						Took:     finished.Sub(started),
-					}
+				books, err := queryBooks(db, filter)
+				if err != nil {
+					return err
+				}
+				slices.SortStableFunc(books, compare)
+
+				if outputFormat(c, cfg) == "json" {
+					return printJSON(books)
+				}
 
-					fmt.Println(book.String())
+				for _, book := range books {
+					fmt.Println(book.Format(cfg.defaults.dateFormat))
 					fmt.Println()
 				}
 
@@ -463,84 +747,144 @@ var CMD = &cli.Command{
 		},
 		{
 			Name:      "update",
-			Usage:     "update info about a book",
+			Usage:     "update info about a book, only the flags that are set are changed",
 			Arguments: commonArgs,
-			ArgsUsage: "[[title author]|ISBN]",
+			ArgsUsage: "[[title author]|ISBN|id]",
 			Flags:     updateFlags,
 			Action: func(ctx context.Context, c *cli.Command) error {
-				err := requireAuthorTitleOrISBN(c)
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				book, err := resolveBookArgs(db, c)
 				if err != nil {
 					return err
 				}
 
-				isbnSet, title, author, isbn, err := determineTitleAuthorISBNAndISBNisSet(c)
-				if err != nil {
-					return err
+				set := []string{}
+				args := []any{}
+				update := func(column string, value any) {
+					set = append(set, column+" = ?")
+					args = append(args, value)
 				}
 
-				db := ctx.Value(myCtx{}).(*sql.DB)
-
-				if isbnSet {
-					if err := isbnExists(db, isbn, true); err != nil {
-						return err
+				if c.IsSet("isbn") {
+					isbn := canonicalISBN(c.String("isbn"))
+					if isbn != book.ISBN {
+						if err := isbnExists(db, isbn, false); err != nil {
+							return err
+						}
 					}
-
-					const QUERY = "UPDATE books COL = ?, COL2 = ? WHERE isbn = ?"
-					_, err = db.Exec(QUERY, "", "", isbn)
+					update("isbn", isbn)
+					update("isbn_original", cleanISBN(c.String("isbn")))
+				}
+				if c.IsSet("title") || c.IsSet("author") {
+					title, author := book.Title, book.Author
+					if c.IsSet("title") {
+						title = strings.TrimSpace(c.String("title"))
+					}
+					if c.IsSet("author") {
+						author = joinAuthors(c.String("author"))
+					}
+					// fixing the casing of a title is not a new book
+					if normaliseName(title) != normaliseName(book.Title) || normaliseName(author) != normaliseName(book.Author) {
+						if err := titleAuthorExists(db, title, author, false); err != nil {
+							return err
+						}
+					}
+					update("title", title)
+					update("title_key", normaliseName(title))
+					update("author", author)
+					update("author_key", normaliseName(author))
+				}
+				if c.IsSet("series") {
+					series := strings.TrimSpace(c.String("series"))
+					update("series", series)
+					update("series_key", normaliseName(series))
+				}
+				if c.IsSet("series-position") {
+					update("series_position", c.Float("series-position"))
+				}
+				if c.IsSet("state") {
+					state, err := parseBookState(c.String("state"))
 					if err != nil {
 						return err
 					}
-				} else {
-					if err := titleAuthorExists(db, title, author, true); err != nil {
+					update("status", state)
+				}
+				if c.IsSet("started") {
+					started, err := flagDateEcho(c, "started")
+					if err != nil {
 						return err
 					}
-
-					const QUERY = "UPDATE books COL = ?, COL2 = ? WHERE title = ? AND author = ?"
-					_, err = db.Exec(QUERY, "", "", strings.ToLower(title), strings.ToLower(author))
+					update("date_started", storedTime(started))
+				}
+				if c.IsSet("finished") {
+					finished, err := flagDateEcho(c, "finished")
 					if err != nil {
 						return err
 					}
+					update("date_finished", storedTime(finished))
 				}
-				return nil
+				if c.IsSet("genres") {
+					genres := c.StringSlice("genres")
+					for ix, genre := range genres {
+						genres[ix] = strings.ToLower(genre)
+					}
+					update("genres", strings.Join(genres, ","))
+				}
+				if c.IsSet("rating") {
+					update("rating", flagRating(c))
+				}
+				if c.IsSet("review") {
+					update("review", flagReview(c))
+				}
+				if c.IsSet("pages") {
+					update("pages", storedPages(c.Int("pages")))
+				}
+
+				credited := c.IsSet("author")
+				for _, role := range AUTHOR_ROLES[1:] {
+					credited = credited || c.IsSet(role)
+				}
+				if len(set) == 0 && !credited {
+					return errors.New("nothing to update, set at least one of --isbn --title --author --translator --illustrator --narrator --series --series-position --state --started --finished --genres --rating --review --pages")
+				}
+				author := ""
+				if c.IsSet("author") {
+					author = c.String("author")
+				}
+				return execAll(db, func(tx *sql.Tx) error {
+					if len(set) > 0 {
+						args = append(args, book.ID)
+						if _, err := tx.Exec("UPDATE books SET "+strings.Join(set, ", ")+" WHERE id = ?", args...); err != nil {
+							return err
+						}
+					}
+					return setCreditsFromFlags(tx, c, book.ID, author)
+				})
 			},
 		},
 		{
 			Name:      "remove",
 			Usage:     "remove a book from the database",
 			Arguments: commonArgs,
-			ArgsUsage: "[[title author]|ISBN]",
+			ArgsUsage: "[[title author]|ISBN|id]",
 			Action: func(ctx context.Context, c *cli.Command) error {
-				if err := requireAuthorTitleOrISBN(c); err != nil {
-					return err
-				}
-
-				isbnSet, title, author, isbn, err := determineTitleAuthorISBNAndISBNisSet(c)
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				book, err := resolveBookArgs(db, c)
 				if err != nil {
 					return err
 				}
 
-				db := ctx.Value(myCtx{}).(*sql.DB)
-
-				if isbnSet {
-					if err := isbnExists(db, isbn, true); err != nil {
-						return err
-					}
-
-					const QUERY = "DELETE FROM books WHERE isbn = ?"
-					_, err := db.Exec(QUERY, isbn)
-					if err != nil {
-						return err
-					}
-				} else {
-					if err := titleAuthorExists(db, title, author, true); err != nil {
+				// drop the cover first so its files are cleaned up if nothing else uses them
+				if book.CoverPath != "" {
+					if err := removeCover(db, book); err != nil {
 						return err
 					}
+				}
 
-					const QUERY = "DELETE FROM books WHERE title = ? AND author = ?"
-					_, err := db.Exec(QUERY, strings.ToLower(title), strings.ToLower(author))
-					if err != nil {
-						return err
-					}
+				const QUERY = "DELETE FROM books WHERE id = ?"
+				_, err = db.Exec(QUERY, book.ID)
+				if err != nil {
+					return err
 				}
 
 				return nil
@@ -550,41 +894,67 @@ var CMD = &cli.Command{
 			Name:      "search",
 			Usage:     "lookup an ISBN number",
 			Arguments: []cli.Argument{&cli.StringArg{Name: "isbn"}},
-			Action: func(_ context.Context, c *cli.Command) error {
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "provider",
+					Usage: "the metadata `providers` to try in order",
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
 				isbn := c.StringArg("isbn")
-				if !validISBN(isbn) {
-					return fmt.Errorf("'%s' is an invalid isbn number", isbn)
+				if _, err := parseISBN(isbn); err != nil {
+					return err
 				}
 
-				fmt.Printf("searching '%s' on openlibrary\n", isbn)
-				cleanISBN := cleanISBN(isbn)
-				query := fmt.Sprintf("https://openlibrary.org/search.json?q=%s&fields=title,author_name", cleanISBN)
-				resp, err := http.Get(query)
-				if err != nil {
-					panic(err)
-				}
-				fmt.Printf("successfully found '%s'\n", isbn)
-
-				body, err := io.ReadAll(resp.Body)
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				cfg := ctx.Value(configCtx{}).(config)
+				providers, err := providersFromFlag(c, cfg)
 				if err != nil {
 					return err
 				}
 
-				var json_ struct {
-					Docs []struct {
-						Author_names []string `json:"author_name"`
-						Title        string   `json:"title"`
-					} `json:"docs"`
+				var found []Metadata
+				for _, p := range providers {
+					fmt.Printf("searching '%s' on %s\n", isbn, p.name)
+					found, err = lookupISBN(db, c.Bool("offline"), p, canonicalISBN(isbn))
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "WARN: %s\n", err)
+						continue
+					}
+					if len(found) > 0 {
+						break
+					}
 				}
-				if err := json.Unmarshal(body, &json_); err != nil {
-					return err
+				if len(found) == 0 {
+					return fmt.Errorf("could not find '%s'", isbn)
 				}
+				fmt.Printf("successfully found '%s'\n", isbn)
 
-				docs0 := json_.Docs[0]
-				fmt.Println("author:", docs0.Author_names)
+				docs0 := found[0]
+				fmt.Println("author:", docs0.Authors)
 				fmt.Println("title:", docs0.Title)
 				return nil
 			},
 		},
+		showCmd,
+		findCmd,
+		shelfCmd,
+		collectionCmd,
+		seriesCmd,
+		nextCmd,
+		authorCmd,
+		statsCmd,
+		goalCmd,
+		reviewYearCmd,
+		streakCmd,
+		logCmd,
+		progressCmd,
+		quoteCmd,
+		cacheCmd,
+		enrichCmd,
+		coverCmd,
+		isbnCmd,
+		configCmd,
+		profileCmd,
 	},
 }
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+)
+
+// collections are hand curated ordered lists of books, positions start at 1
+// and have no gaps. foreign keys are not turned on so the trigger removes a
+// deleted book from its collections
+var CREATECOLLECTIONQUERIES = []string{
+	`CREATE TABLE collections (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);`,
+	`CREATE TABLE collection_books (
+		collection_id INTEGER NOT NULL,
+		book_id INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (collection_id, book_id)
+	);`,
+	`CREATE TRIGGER collection_books_delete AFTER DELETE ON books BEGIN
+		UPDATE collection_books SET position = position - 1
+		WHERE EXISTS (SELECT 1 FROM collection_books AS removed
+			WHERE removed.book_id = old.id
+			AND removed.collection_id = collection_books.collection_id
+			AND collection_books.position > removed.position);
+		DELETE FROM collection_books WHERE book_id = old.id;
+	END;`,
+}
+
+type collectionEntry struct {
+	Position int `json:"position"`
+	Book
+}
+
+func collectionID(db *sql.DB, name string) (int64, error) {
+	var id int64
+	err := db.QueryRow("SELECT id FROM collections WHERE name = ?", name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("collection '%s' does not exist", name)
+	}
+	return id, err
+}
+
+// the position of book in the collection, 0 if it is not in it
+func collectionPosition(db *sql.DB, collection, book int64) (int, error) {
+	const QUERY = "SELECT position FROM collection_books WHERE collection_id = ? AND book_id = ?"
+	var position int
+	err := db.QueryRow(QUERY, collection, book).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return position, err
+}
+
+func collectionSize(db *sql.DB, collection int64) (int, error) {
+	var size int
+	err := db.QueryRow("SELECT COUNT(*) FROM collection_books WHERE collection_id = ?", collection).Scan(&size)
+	return size, err
+}
+
+func collectionBooks(db *sql.DB, collection int64) ([]collectionEntry, error) {
+	const QUERY = "SELECT book_id, position FROM collection_books WHERE collection_id = ? ORDER BY position"
+	rows, err := db.Query(QUERY, collection)
+	if err != nil {
+		return nil, err
+	}
+	entries := []collectionEntry{}
+	for rows.Next() {
+		var entry collectionEntry
+		if err := rows.Scan(&entry.ID, &entry.Position); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for ix := range entries {
+		book, err := getBookByID(db, entries[ix].ID)
+		if err != nil {
+			return nil, err
+		}
+		entries[ix].Book = book
+	}
+	return entries, nil
+}
+
+// the collection named by the first argument and the book named by the rest
+func collectionAndBook(ctx context.Context, c *cli.Command) (*sql.DB, int64, Book, error) {
+	db := ctx.Value(myCtx{}).(*sql.DB)
+	collection, err := collectionID(db, c.StringArg("name"))
+	if err != nil {
+		return nil, 0, Book{}, err
+	}
+	book, err := resolveBookArgs(db, c)
+	return db, collection, book, err
+}
+
+var collectionBookArgs = []cli.Argument{
+	&cli.StringArg{Name: "name"},
+	&cli.StringArg{Name: "title"},
+	&cli.StringArg{Name: "author"},
+}
+
+var positionFlag = &cli.IntFlag{
+	Name:        "position",
+	Aliases:     []string{"to"},
+	Usage:       "the `position` in the collection, starting at 1",
+	DefaultText: "the end",
+}
+
+var collectionCmd = &cli.Command{
+	Name:  "collection",
+	Usage: "curated, ordered lists of books",
+	Commands: []*cli.Command{
+		{
+			Name:      "create",
+			Usage:     "create an empty collection",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				name := c.StringArg("name")
+				if name == "" {
+					return errors.New("a collection name must be provided")
+				}
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				if _, err := collectionID(db, name); err == nil {
+					return fmt.Errorf("collection '%s' already exists", name)
+				}
+				_, err := db.Exec("INSERT INTO collections (name) VALUES(?)", name)
+				return err
+			},
+		},
+		{
+			Name:  "list",
+			Usage: "list every collection and how many books are in it",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				const QUERY = `SELECT c.name, COUNT(cb.book_id) FROM collections c
+					LEFT JOIN collection_books cb ON cb.collection_id = c.id GROUP BY c.id ORDER BY c.name`
+				rows, err := db.Query(QUERY)
+				if err != nil {
+					return err
+				}
+				defer rows.Close()
+				for rows.Next() {
+					var name string
+					var size int
+					if err := rows.Scan(&name, &size); err != nil {
+						return err
+					}
+					fmt.Printf("%s (%d books)\n", name, size)
+				}
+				return rows.Err()
+			},
+		},
+		{
+			Name:      "add",
+			Usage:     "add a book to a collection, at the end unless --position is given",
+			Arguments: collectionBookArgs,
+			ArgsUsage: "NAME [[title author]|ISBN|id]",
+			Flags:     []cli.Flag{positionFlag},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db, collection, book, err := collectionAndBook(ctx, c)
+				if err != nil {
+					return err
+				}
+				if position, err := collectionPosition(db, collection, book.ID); err != nil {
+					return err
+				} else if position != 0 {
+					return fmt.Errorf("'%s' is already in '%s' at position %d", book.Title, c.StringArg("name"), position)
+				}
+
+				size, err := collectionSize(db, collection)
+				if err != nil {
+					return err
+				}
+				position := size + 1
+				if c.IsSet("position") {
+					position = min(max(int(c.Int("position")), 1), size+1)
+				}
+				return execAll(db,
+					execStmt("UPDATE collection_books SET position = position + 1 WHERE collection_id = ? AND position >= ?", collection, position),
+					execStmt("INSERT INTO collection_books (collection_id, book_id, position) VALUES(?, ?, ?)", collection, book.ID, position),
+				)
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "remove a book from a collection",
+			Arguments: collectionBookArgs,
+			ArgsUsage: "NAME [[title author]|ISBN|id]",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db, collection, book, err := collectionAndBook(ctx, c)
+				if err != nil {
+					return err
+				}
+				position, err := collectionPosition(db, collection, book.ID)
+				if err != nil {
+					return err
+				} else if position == 0 {
+					return fmt.Errorf("'%s' is not in '%s'", book.Title, c.StringArg("name"))
+				}
+				return execAll(db,
+					execStmt("DELETE FROM collection_books WHERE collection_id = ? AND book_id = ?", collection, book.ID),
+					execStmt("UPDATE collection_books SET position = position - 1 WHERE collection_id = ? AND position > ?", collection, position),
+				)
+			},
+		},
+		{
+			Name:      "move",
+			Usage:     "move a book to a new position in a collection",
+			Arguments: collectionBookArgs,
+			ArgsUsage: "NAME [[title author]|ISBN|id] --to POSITION",
+			Flags:     []cli.Flag{positionFlag},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				if !c.IsSet("position") {
+					return errors.New("the new position must be given with --to")
+				}
+				db, collection, book, err := collectionAndBook(ctx, c)
+				if err != nil {
+					return err
+				}
+				from, err := collectionPosition(db, collection, book.ID)
+				if err != nil {
+					return err
+				} else if from == 0 {
+					return fmt.Errorf("'%s' is not in '%s'", book.Title, c.StringArg("name"))
+				}
+				size, err := collectionSize(db, collection)
+				if err != nil {
+					return err
+				}
+
+				// everything between the old and new position shifts one place
+				to := min(max(int(c.Int("position")), 1), size)
+				shift := execStmt("UPDATE collection_books SET position = position + 1 WHERE collection_id = ? AND position >= ? AND position < ?", collection, to, from)
+				if to > from {
+					shift = execStmt("UPDATE collection_books SET position = position - 1 WHERE collection_id = ? AND position > ? AND position <= ?", collection, from, to)
+				}
+				return execAll(db,
+					shift,
+					execStmt("UPDATE collection_books SET position = ? WHERE collection_id = ? AND book_id = ?", to, collection, book.ID),
+				)
+			},
+		},
+		{
+			Name:      "show",
+			Usage:     "show the books in a collection in order",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Flags:     []cli.Flag{formatFlag},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				cfg := ctx.Value(configCtx{}).(config)
+				collection, err := collectionID(db, c.StringArg("name"))
+				if err != nil {
+					return err
+				}
+				entries, err := collectionBooks(db, collection)
+				if err != nil {
+					return err
+				}
+
+				if outputFormat(c, cfg) == "json" {
+					return printJSON(entries)
+				}
+				for _, entry := range entries {
+					fmt.Printf("%3d. %s by %s (%s)\n", entry.Position, entry.Title, entry.Author, entry.Status)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "delete",
+			Usage:     "delete a collection, the books in it are left alone",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				collection, err := collectionID(db, c.StringArg("name"))
+				if err != nil {
+					return err
+				}
+				return execAll(db,
+					execStmt("DELETE FROM collection_books WHERE collection_id = ?", collection),
+					execStmt("DELETE FROM collections WHERE id = ?", collection),
+				)
+			},
+		},
+	},
+}
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+type configCtx struct{}
+
+// the [defaults] section of the config file
+type configDefaults struct {
+	// the state `add` uses when --state is not given
+	state BookState
+	// the go time layout dates are displayed with
+	dateFormat string
+	// one of 'text' 'json'
+	outputFormat string
+	// the metadata providers to try, in order
+	providers []string
+	// nil means the system timezone
+	timezone *time.Location
+	// empty means $VISUAL or $EDITOR
+	editor string
+	// the states of the books whose spans count towards a streak
+	streakStates []BookState
+	// how many days in a row can be missed without breaking a streak
+	streakGraceDays int
+	// also count the days between starting and finishing a book as reading
+	// days, not just the days in the reading log
+	streakSpans bool
+}
+
+// a [profile.NAME] section, a profile is a separate library with its own
+// database and its own defaults
+type profileConfig struct {
+	name string
+	// empty means NAME.db in the data directory
+	dbPath string
+	// [defaults] keys set by the profile, applied on top of [defaults]
+	overrides [][2]string
+}
+
+type config struct {
+	dbPath   string
+	defaults configDefaults
+	// the profile used when --profile is not given
+	defaultProfile string
+	profiles       []*profileConfig
+	// the profile in use, empty for the default library
+	profile string
+	// the config before the profile was applied, nil if none has been
+	base *config
+}
+
+// the name used for the library that is not a profile
+const DEFAULT_PROFILE = "default"
+
+func validProfileName(name string) error {
+	if name == "" {
+		return errors.New("profile name can not be empty")
+	}
+	if name == DEFAULT_PROFILE {
+		return fmt.Errorf("'%s' is reserved for the library that is not a profile", DEFAULT_PROFILE)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("'%s' is not a valid profile name, names can only contain letters, digits, '-' and '_'", name)
+		}
+	}
+	return nil
+}
+
+func (c *config) findProfile(name string) *profileConfig {
+	for _, p := range c.profiles {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// returns the config with the profiles db path and defaults applied, an empty
+// name or DEFAULT_PROFILE is the library that is not a profile
+func (c config) withProfile(name string) (config, error) {
+	// a profile goes on top of the config file, not on top of another profile
+	if c.base != nil {
+		c = *c.base
+	}
+	base := c
+	c.base = &base
+	if name == "" || name == DEFAULT_PROFILE {
+		c.profile = ""
+		return c, nil
+	}
+
+	p := c.findProfile(name)
+	if p == nil {
+		return config{}, fmt.Errorf("profile '%s' does not exist", name)
+	}
+	for _, kv := range p.overrides {
+		if err := c.set("defaults", kv[0], kv[1]); err != nil {
+			return config{}, err
+		}
+	}
+	c.dbPath = p.dbPath
+	c.profile = p.name
+	return c, nil
+}
+
+func defaultConfig() config {
+	return config{
+		defaults: configDefaults{
+			state:        BS_NONE,
+			dateFormat:   time.DateTime,
+			outputFormat: "text",
+			providers:    slices.Clone(PROVIDER_ORDER),
+			streakStates: slices.Clone(STREAK_STATES),
+		},
+	}
+}
+
+// a problem on a specific line of a config file
+type ConfigError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+// parses a config value, values can be "double quoted" with go style escapes,
+// 'single quoted' which are taken literally, or bare. bare values end at a '#'
+// or ';' comment
+func parseConfigValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '"':
+		end := 1
+		for ; end < len(raw); end++ {
+			if raw[end] == '\\' {
+				end++
+			} else if raw[end] == '"' {
+				break
+			}
+		}
+		if end >= len(raw) {
+			return "", errors.New("unterminated quoted value")
+		}
+		value, err := strconv.Unquote(raw[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", raw[:end+1])
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && rest[0] != '#' && rest[0] != ';' {
+			return "", fmt.Errorf("unexpected '%s' after quoted value", rest)
+		}
+		return value, nil
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end == -1 {
+			return "", errors.New("unterminated quoted value")
+		}
+		if rest := strings.TrimSpace(raw[end+2:]); rest != "" && rest[0] != '#' && rest[0] != ';' {
+			return "", fmt.Errorf("unexpected '%s' after quoted value", rest)
+		}
+		return raw[1 : end+1], nil
+	default:
+		if ix := strings.IndexAny(raw, "#;"); ix != -1 {
+			raw = raw[:ix]
+		}
+		return strings.TrimSpace(raw), nil
+	}
+}
+
+// checks section is a known section, creating the profile for [profile.NAME]
+func (c *config) addSection(section string) error {
+	if section == "defaults" {
+		return nil
+	}
+	name, isProfile := strings.CutPrefix(section, "profile.")
+	if !isProfile {
+		return fmt.Errorf("unknown section [%s], must be [defaults] or [profile.NAME]", section)
+	}
+	if err := validProfileName(name); err != nil {
+		return err
+	}
+	if c.findProfile(name) == nil {
+		c.profiles = append(c.profiles, &profileConfig{name: name})
+	}
+	return nil
+}
+
+// sets key in section, returns an error message if the key or value is invalid
+func (c *config) set(section, key, value string) error {
+	switch section {
+	case "":
+		switch key {
+		case "db_path":
+			c.dbPath = value
+		case "profile":
+			c.defaultProfile = value
+		default:
+			return fmt.Errorf("unknown key '%s', must be one of 'db_path' 'profile'", key)
+		}
+	case "defaults":
+		switch key {
+		case "state":
+			state, err := parseBookState(value)
+			if err != nil {
+				return err
+			}
+			c.defaults.state = state
+		case "date_format":
+			if value == "" {
+				return errors.New("date_format can not be empty")
+			}
+			c.defaults.dateFormat = value
+		case "output_format":
+			if value != "text" && value != "json" {
+				return fmt.Errorf("'%s' is not a valid output format, must be one of 'text' 'json'", value)
+			}
+			c.defaults.outputFormat = value
+		case "providers":
+			providers := []string{}
+			for name := range strings.SplitSeq(value, ",") {
+				name = strings.ToLower(strings.TrimSpace(name))
+				if _, ok := PROVIDERS[name]; !ok {
+					return fmt.Errorf("'%s' is not a metadata provider, must be one of 'openlibrary' 'google'", name)
+				}
+				providers = append(providers, name)
+			}
+			c.defaults.providers = providers
+		case "timezone":
+			// LoadLocation treats "" as UTC, but here it means the system timezone
+			if value == "" {
+				c.defaults.timezone = nil
+				break
+			}
+			loc, err := time.LoadLocation(value)
+			if err != nil {
+				return fmt.Errorf("'%s' is not a valid timezone", value)
+			}
+			c.defaults.timezone = loc
+		case "editor":
+			c.defaults.editor = value
+		case "streak_states":
+			states := []BookState{}
+			for name := range strings.SplitSeq(value, ",") {
+				state, err := parseBookState(strings.TrimSpace(name))
+				if err != nil || !slices.Contains(STREAK_STATES, state) {
+					return fmt.Errorf("'%s' can not count towards a streak, must be one of 'reading' 'finished' 'dnf'", strings.TrimSpace(name))
+				}
+				states = append(states, state)
+			}
+			c.defaults.streakStates = states
+		case "streak_grace_days":
+			days, err := strconv.Atoi(value)
+			if err != nil || days < 0 {
+				return fmt.Errorf("'%s' is not a valid number of grace days", value)
+			}
+			c.defaults.streakGraceDays = days
+		case "streak_spans":
+			spans, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("'%s' is not a valid streak_spans, must be one of 'true' 'false'", value)
+			}
+			c.defaults.streakSpans = spans
+		default:
+			return fmt.Errorf(
+				"unknown key '%s' in [defaults], must be one of 'state' 'date_format' 'output_format' 'providers' 'timezone' 'editor' 'streak_states' 'streak_grace_days' 'streak_spans'",
+				key)
+		}
+	default:
+		if err := c.addSection(section); err != nil {
+			return err
+		}
+		p := c.findProfile(strings.TrimPrefix(section, "profile."))
+		if key == "db_path" {
+			p.dbPath = value
+			return nil
+		}
+
+		// check the value now so the error has the right line number
+		scratch := defaultConfig()
+		if err := scratch.set("defaults", key, value); err != nil {
+			return err
+		}
+		p.overrides = append(p.overrides, [2]string{key, value})
+	}
+	return nil
+}
+
+func parseConfig(path string, data []byte) (config, error) {
+	c := defaultConfig()
+	section := ""
+	seen := map[string]bool{}
+	// profiles can be defined after `profile = NAME` so it is checked at the end
+	profileLine := 0
+
+	lineNo := 0
+	for line := range bytes.Lines(data) {
+		lineNo++
+		text := strings.TrimSpace(string(line))
+		if text == "" || text[0] == '#' || text[0] == ';' {
+			continue
+		}
+
+		if text[0] == '[' {
+			end := strings.IndexByte(text, ']')
+			if end == -1 {
+				return config{}, &ConfigError{path, lineNo, "section header is missing a closing ']'"}
+			}
+			section = strings.TrimSpace(text[1:end])
+			if section == "" {
+				return config{}, &ConfigError{path, lineNo, "section name can not be empty"}
+			}
+			if seen["["+section+"]"] {
+				return config{}, &ConfigError{path, lineNo, fmt.Sprintf("duplicate section [%s]", section)}
+			}
+			seen["["+section+"]"] = true
+			if err := c.addSection(section); err != nil {
+				return config{}, &ConfigError{path, lineNo, err.Error()}
+			}
+			continue
+		}
+
+		key, rawValue, found := strings.Cut(text, "=")
+		if !found {
+			return config{}, &ConfigError{path, lineNo, fmt.Sprintf("expected `key = value` but found '%s'", text)}
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return config{}, &ConfigError{path, lineNo, "key can not be empty"}
+		}
+		if seen[section+"."+key] {
+			return config{}, &ConfigError{path, lineNo, fmt.Sprintf("duplicate key '%s'", key)}
+		}
+		seen[section+"."+key] = true
+
+		value, err := parseConfigValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return config{}, &ConfigError{path, lineNo, err.Error()}
+		}
+		if err := c.set(section, key, value); err != nil {
+			return config{}, &ConfigError{path, lineNo, err.Error()}
+		}
+		if section == "" && key == "profile" {
+			profileLine = lineNo
+		}
+	}
+
+	if c.defaultProfile != "" && c.defaultProfile != DEFAULT_PROFILE && c.findProfile(c.defaultProfile) == nil {
+		return config{}, &ConfigError{path, profileLine, fmt.Sprintf("profile '%s' does not exist", c.defaultProfile)}
+	}
+	return c, nil
+}
+
+func ReadConfigFile(path string) (config, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return config{}, err
+	}
+	return parseConfig(path, f)
+}
+
+// returns the config in the config file format
+func (c config) String() string {
+	var sb strings.Builder
+	if c.profile != "" {
+		fmt.Fprintf(&sb, "# using profile '%s'\n", c.profile)
+	}
+	if c.dbPath != "" {
+		fmt.Fprintf(&sb, "db_path = %s\n", strconv.Quote(c.dbPath))
+	}
+	if c.defaultProfile != "" {
+		fmt.Fprintf(&sb, "profile = %s\n", c.defaultProfile)
+	}
+	if c.dbPath != "" || c.defaultProfile != "" {
+		sb.WriteByte('\n')
+	}
+
+	timezone := ""
+	if c.defaults.timezone != nil {
+		timezone = c.defaults.timezone.String()
+	}
+	fmt.Fprintln(&sb, "[defaults]")
+	fmt.Fprintf(&sb, "state = %s\n", strings.ToLower(c.defaults.state.String()))
+	fmt.Fprintf(&sb, "date_format = %s\n", strconv.Quote(c.defaults.dateFormat))
+	fmt.Fprintf(&sb, "output_format = %s\n", c.defaults.outputFormat)
+	fmt.Fprintf(&sb, "providers = %s\n", strings.Join(c.defaults.providers, ", "))
+	fmt.Fprintf(&sb, "timezone = %s\n", strconv.Quote(timezone))
+	fmt.Fprintf(&sb, "editor = %s\n", strconv.Quote(c.defaults.editor))
+	states := []string{}
+	for _, state := range c.defaults.streakStates {
+		states = append(states, strings.ToLower(state.String()))
+	}
+	fmt.Fprintf(&sb, "streak_states = %s\n", strings.Join(states, ", "))
+	fmt.Fprintf(&sb, "streak_grace_days = %d\n", c.defaults.streakGraceDays)
+	fmt.Fprintf(&sb, "streak_spans = %t\n", c.defaults.streakSpans)
+
+	for _, p := range c.profiles {
+		fmt.Fprintf(&sb, "\n[profile.%s]\n", p.name)
+		if p.dbPath != "" {
+			fmt.Fprintf(&sb, "db_path = %s\n", strconv.Quote(p.dbPath))
+		}
+		for _, kv := range p.overrides {
+			fmt.Fprintf(&sb, "%s = %s\n", kv[0], strconv.Quote(kv[1]))
+		}
+	}
+	return sb.String()
+}
+
+func configPath() (string, error) {
+	xdg_config_home, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(xdg_config_home, "bookTracker", "bookTracker.conf"), nil
+}
+
+func configEditor(c config) string {
+	if c.defaults.editor != "" {
+		return c.defaults.editor
+	}
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(env); editor != "" {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// loads the config file, creating it with the default config if it does not exist
+func GetConfig() (config, error) {
+	path_, err := configPath()
+	if err != nil {
+		return config{}, err
+	}
+
+	if _, err := os.Stat(path_); errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "INFO: `%s` does not exist creating it\n", path_)
+
+		err = os.MkdirAll(path.Dir(path_), os.ModePerm)
+		if err != nil {
+			return config{}, err
+		}
+
+		err = os.WriteFile(path_, []byte(defaultConfig().String()), 0666)
+		if err != nil {
+			return config{}, err
+		}
+	}
+
+	return ReadConfigFile(path_)
+}
+
+var configCmd = &cli.Command{
+	Name:     "config",
+	Usage:    "inspect and edit the config file",
+	Metadata: map[string]any{SKIP_SETUP: true},
+	Commands: []*cli.Command{
+		{
+			Name:  "show",
+			Usage: "print the config currently in use",
+			Action: func(_ context.Context, c *cli.Command) error {
+				cfg, err := loadConfig(c)
+				if err != nil {
+					return err
+				}
+				fmt.Print(cfg)
+				return nil
+			},
+		},
+		{
+			Name:  "path",
+			Usage: "print the path of the config file",
+			Action: func(_ context.Context, c *cli.Command) error {
+				path_, err := configPath()
+				if err != nil {
+					return err
+				}
+				fmt.Println(path_)
+				return nil
+			},
+		},
+		{
+			Name:  "edit",
+			Usage: "open the config file in your editor",
+			Action: func(_ context.Context, c *cli.Command) error {
+				path_, err := configPath()
+				if err != nil {
+					return err
+				}
+
+				// start from the current config so every key is there to edit
+				if _, err := os.Stat(path_); errors.Is(err, os.ErrNotExist) {
+					if err := os.MkdirAll(path.Dir(path_), os.ModePerm); err != nil {
+						return err
+					}
+					if err := os.WriteFile(path_, []byte(defaultConfig().String()), 0666); err != nil {
+						return err
+					}
+				}
+
+				// a broken config is what edit is there to fix, so it is opened
+				// anyway with the editor from the environment
+				cfg, err := ReadConfigFile(path_)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "WARN: %s\n", err)
+					cfg = defaultConfig()
+				}
+				// the editor may have arguments, like `code --wait`
+				editor := strings.Fields(configEditor(cfg))
+				cmd := exec.Command(editor[0], append(editor[1:], path_)...)
+				cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+				if err := cmd.Run(); err != nil {
+					return err
+				}
+
+				if _, err := ReadConfigFile(path_); err != nil {
+					return fmt.Errorf("the config file is not valid: %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "validate",
+			Usage:     "check a config file for errors",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "file"}},
+			ArgsUsage: "[file]",
+			Action: func(_ context.Context, c *cli.Command) error {
+				path_ := c.StringArg("file")
+				if path_ == "" {
+					var err error
+					if path_, err = configPath(); err != nil {
+						return err
+					}
+				}
+
+				if _, err := ReadConfigFile(path_); err != nil {
+					return err
+				}
+				fmt.Printf("'%s' is valid\n", path_)
+				return nil
+			},
+		},
+	},
+}
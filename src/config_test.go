@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	const CONFIG = `# a comment
+db_path = "/books/main.db"
+profile = work
+
+[defaults]
+state = tbr ; a comment
+date_format = '2006-01-02 # not a comment'
+output_format = "json"
+providers = google, OpenLibrary
+streak_grace_days = 2
+streak_spans = true
+
+[profile.work]
+db_path = /books/work.db
+output_format = text
+streak_states = finished
+`
+	c, err := parseConfig("config.ini", []byte(CONFIG))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"db_path", c.dbPath, "/books/main.db"},
+		{"profile", c.defaultProfile, "work"},
+		{"state", c.defaults.state, BS_TBR},
+		{"date_format", c.defaults.dateFormat, "2006-01-02 # not a comment"},
+		{"output_format", c.defaults.outputFormat, "json"},
+		{"providers", strings.Join(c.defaults.providers, ","), "google,openlibrary"},
+		{"streak_grace_days", c.defaults.streakGraceDays, 2},
+		{"streak_spans", c.defaults.streakSpans, true},
+		// not set, so the default
+		{"streak_states", len(c.defaults.streakStates), len(STREAK_STATES)},
+		{"profiles", len(c.profiles), 1},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("parseConfig() %s = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		line   int
+		msg    string
+	}{
+		{"bogus = 1", 1, "unknown key 'bogus'"},
+		{"\n[defaults]\ncolour = red", 3, "unknown key 'colour' in [defaults]"},
+		{"[defaults]\nstate = tbr\nstate = reading", 3, "duplicate key 'state'"},
+		{"[defaults]\n[defaults]", 2, "duplicate section [defaults]"},
+		{"[shelves]", 1, "unknown section [shelves]"},
+		{"[defaults", 1, "missing a closing ']'"},
+		{"[]", 1, "section name can not be empty"},
+		{"[profile.default]", 1, "reserved"},
+		{"[profile.a b]", 1, "not a valid profile name"},
+		{"db_path", 1, "expected `key = value`"},
+		{"= 1", 1, "key can not be empty"},
+		{`db_path = "unterminated`, 1, "unterminated quoted value"},
+		{`db_path = 'a' b`, 1, "unexpected 'b' after quoted value"},
+		{`db_path = "\q"`, 1, "invalid quoted value"},
+		{"[defaults]\noutput_format = xml", 2, "not a valid output format"},
+		{"[defaults]\nproviders = openlibrary, amazon", 2, "'amazon' is not a metadata provider"},
+		{"[defaults]\ntimezone = Mars/Olympus", 2, "not a valid timezone"},
+		{"[defaults]\nstreak_states = tbr", 2, "'tbr' can not count towards a streak"},
+		{"[defaults]\nstreak_grace_days = -1", 2, "not a valid number of grace days"},
+		{"[defaults]\nstreak_spans = maybe", 2, "not a valid streak_spans"},
+		// a profile is checked when it is read, so the line is the profiles
+		{"[profile.work]\n\nstate = shelved", 3, "state"},
+		// and the default profile once the whole file has been read
+		{"profile = home\n[profile.work]", 1, "profile 'home' does not exist"},
+	}
+
+	for _, test := range tests {
+		_, err := parseConfig("config.ini", []byte(test.config))
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			t.Errorf("parseConfig(%q) = %v, want a *ConfigError", test.config, err)
+			continue
+		}
+		if configErr.Line != test.line || !strings.Contains(configErr.Msg, test.msg) {
+			t.Errorf("parseConfig(%q) = %v, want line %d containing %q", test.config, err, test.line, test.msg)
+		}
+	}
+}
+
+func TestWithProfile(t *testing.T) {
+	const CONFIG = `db_path = /books/main.db
+[defaults]
+output_format = json
+streak_grace_days = 1
+[profile.work]
+db_path = /books/work.db
+output_format = text
+[profile.kids]
+streak_grace_days = 3
+`
+	c, err := parseConfig("config.ini", []byte(CONFIG))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		profile string
+		dbPath  string
+		format  string
+		grace   int
+		ok      bool
+	}{
+		{profile: "", dbPath: "/books/main.db", format: "json", grace: 1, ok: true},
+		{profile: DEFAULT_PROFILE, dbPath: "/books/main.db", format: "json", grace: 1, ok: true},
+		{profile: "work", dbPath: "/books/work.db", format: "text", grace: 1, ok: true},
+		// without a db_path the profile uses NAME.db in the data directory
+		{profile: "kids", dbPath: "", format: "json", grace: 3, ok: true},
+		{profile: "home"},
+	}
+
+	for _, test := range tests {
+		got, err := c.withProfile(test.profile)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("withProfile(%q) = %+v, want an error", test.profile, got)
+			}
+			continue
+		}
+		if err != nil || got.dbPath != test.dbPath || got.defaults.outputFormat != test.format || got.defaults.streakGraceDays != test.grace {
+			t.Errorf("withProfile(%q) = %q, %q, %d, %v, want %q, %q, %d",
+				test.profile, got.dbPath, got.defaults.outputFormat, got.defaults.streakGraceDays, err, test.dbPath, test.format, test.grace)
+		}
+	}
+
+	// a profile is applied to the config file, not to the profile before it
+	work, err := c.withProfile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kids, err := work.withProfile("kids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kids.defaults.outputFormat != "json" || kids.profile != "kids" {
+		t.Errorf("withProfile(\"kids\") after \"work\" = %q, %q, want \"json\", \"kids\"", kids.defaults.outputFormat, kids.profile)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+const OPEN_LIBRARY_COVERS_URL = "https://covers.openlibrary.org/b"
+
+// small, medium and large, in the order they are fetched
+var COVER_SIZES = []string{"L", "M", "S"}
+
+// covers are stored in covers/<sha256 of the large variant>/{S,M,L}.jpg under
+// the data directory, so books sharing the same cover share the files
+func coversDir() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "covers"), nil
+}
+
+// returns the absolute path of the size variant of a books cover
+func coverFile(book Book, size string) (string, error) {
+	if book.CoverPath == "" {
+		return "", fmt.Errorf("'%s' does not have a cover, use `cover fetch` to get one", book.Title)
+	}
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, book.CoverPath, size+".jpg"), nil
+}
+
+func validCoverSize(_ context.Context, _ *cli.Command, s string) error {
+	switch s {
+	case "S", "M", "L":
+		return nil
+	default:
+		return fmt.Errorf("'%s' is not a valid cover size, size must be one of 'S' 'M' 'L'", s)
+	}
+}
+
+// the open library url for a cover, keyed on isbn if the book has one
+// otherwise on the cover id
+func coverURL(isbn string, coverID int, size string) string {
+	if isbn != "" {
+		return fmt.Sprintf("%s/isbn/%s-%s.jpg?default=false", OPEN_LIBRARY_COVERS_URL, isbn, size)
+	}
+	return fmt.Sprintf("%s/id/%d-%s.jpg?default=false", OPEN_LIBRARY_COVERS_URL, coverID, size)
+}
+
+// downloads every size variant and returns the cover path relative to the data directory
+func fetchCover(isbn string, coverID int) (string, error) {
+	variants := map[string][]byte{}
+	for _, size := range COVER_SIZES {
+		data, err := httpGet(coverURL(isbn, coverID, size))
+		if err != nil {
+			return "", err
+		}
+		variants[size] = data
+	}
+
+	hash := sha256.Sum256(variants["L"])
+	relPath := filepath.Join("covers", hex.EncodeToString(hash[:]))
+
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, relPath), os.ModePerm); err != nil {
+		return "", err
+	}
+	for size, data := range variants {
+		if err := os.WriteFile(filepath.Join(dir, relPath, size+".jpg"), data, 0666); err != nil {
+			return "", err
+		}
+	}
+	return relPath, nil
+}
+
+// removes the cover from book and deletes the files if no other book uses them
+func removeCover(db *sql.DB, book Book) error {
+	const QUERY = "UPDATE books SET cover_path = NULL WHERE id = ?"
+	if _, err := db.Exec(QUERY, book.ID); err != nil {
+		return err
+	}
+
+	const USEDQUERY = "SELECT EXISTS(SELECT 1 FROM books WHERE cover_path = ?)"
+	var used int
+	if err := db.QueryRow(USEDQUERY, book.CoverPath).Scan(&used); err != nil {
+		return err
+	}
+	if used == 1 {
+		return nil
+	}
+
+	dir, err := dataDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(dir, book.CoverPath))
+}
+
+func coverBook(ctx context.Context, c *cli.Command) (*sql.DB, Book, error) {
+	db := ctx.Value(myCtx{}).(*sql.DB)
+	book, err := resolveBookArgs(db, c)
+	return db, book, err
+}
+
+var coverCmd = &cli.Command{
+	Name:  "cover",
+	Usage: "download and manage book covers",
+	Commands: []*cli.Command{
+		{
+			Name:      "fetch",
+			Usage:     "download the cover for a book from openlibrary",
+			Arguments: commonArgs,
+			ArgsUsage: "[[title author]|ISBN]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "fetch the cover even if the book already has one",
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				if c.Bool("offline") {
+					return errors.New("can not fetch covers with --offline set")
+				}
+				db, book, err := coverBook(ctx, c)
+				if err != nil {
+					return err
+				}
+				if book.CoverPath != "" && !c.Bool("force") {
+					return fmt.Errorf("'%s' already has a cover, use --force to fetch it again", book.Title)
+				}
+
+				coverID := 0
+				if book.ISBN == "" {
+					found, err := lookupQuery(db, false, openLibrary, book.Title+" "+book.Author)
+					if err != nil {
+						return err
+					}
+					for _, meta := range found {
+						if strings.EqualFold(meta.Title, book.Title) && meta.CoverID != 0 {
+							coverID = meta.CoverID
+							break
+						}
+					}
+					if coverID == 0 {
+						return fmt.Errorf("could not find a cover for '%s'", book.Title)
+					}
+				}
+
+				relPath, err := fetchCover(book.ISBN, coverID)
+				if err != nil {
+					return err
+				}
+
+				if book.CoverPath != "" && book.CoverPath != relPath {
+					if err := removeCover(db, book); err != nil {
+						return err
+					}
+				}
+				const QUERY = "UPDATE books SET cover_path = ? WHERE id = ?"
+				if _, err := db.Exec(QUERY, relPath, book.ID); err != nil {
+					return err
+				}
+				fmt.Printf("saved cover for '%s'\n", book.Title)
+				return nil
+			},
+		},
+		{
+			Name:      "show-path",
+			Usage:     "print the path to a books cover",
+			Arguments: commonArgs,
+			ArgsUsage: "[[title author]|ISBN]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:   "size",
+					Usage:  "the `size` of the cover, must be one of 'S' 'M' 'L'",
+					Value:  "M",
+					Action: validCoverSize,
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				_, book, err := coverBook(ctx, c)
+				if err != nil {
+					return err
+				}
+				path, err := coverFile(book, c.String("size"))
+				if err != nil {
+					return err
+				}
+				fmt.Println(path)
+				return nil
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "remove the cover from a book",
+			Arguments: commonArgs,
+			ArgsUsage: "[[title author]|ISBN]",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db, book, err := coverBook(ctx, c)
+				if err != nil {
+					return err
+				}
+				if book.CoverPath == "" {
+					return fmt.Errorf("'%s' does not have a cover", book.Title)
+				}
+				return removeCover(db, book)
+			},
+		},
+	},
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// the layouts accepted by --started and --finished, anything without a
+// timezone is in local time and a date on its own is midnight
+var DATE_LAYOUTS = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.DateOnly,
+	"2006-01",
+	"Jan 2 2006",
+	"Jan 2, 2006",
+	"January 2 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+// month and day without a year, these resolve to the most recent one
+var MONTH_DAY_LAYOUTS = []string{"Jan 2", "January 2", "2 Jan", "2 January"}
+
+const DATE_HELP = "use 2006-01-02, 2006-01-02T15:04:05, 2006-01, 'oct 3', 'today', 'yesterday', 'last friday' or '3 days ago'"
+
+func parseDate(s string) (time.Time, error) {
+	return parseDateFrom(s, time.Now())
+}
+
+// parses s, with relative dates resolved against now
+func parseDateFrom(input string, now time.Time) (time.Time, error) {
+	s := strings.Join(strings.Fields(strings.ToLower(input)), " ")
+	if t, ok := relativeDate(s, now); ok {
+		return t, nil
+	}
+	for _, layout := range DATE_LAYOUTS {
+		// month names are matched case insensitively, the T and Z are not
+		if t, err := time.ParseInLocation(layout, strings.ToUpper(s), time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	today := midnight(now)
+	for _, layout := range MONTH_DAY_LAYOUTS {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		t = time.Date(today.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		if t.After(today) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("'%s' is not a valid date, %s", input, DATE_HELP)
+}
+
+func midnight(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// now, today, yesterday, last <weekday> and <n> <unit>s ago
+func relativeDate(s string, now time.Time) (time.Time, bool) {
+	today := midnight(now)
+	switch s {
+	case "now":
+		return now, true
+	case "today":
+		return today, true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 2 && fields[0] == "last" {
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			name := strings.ToLower(wd.String())
+			if fields[1] != name && fields[1] != name[:3] {
+				continue
+			}
+			days := (int(today.Weekday()) - int(wd) + 7) % 7
+			if days == 0 {
+				days = 7
+			}
+			return today.AddDate(0, 0, -days), true
+		}
+		return time.Time{}, false
+	}
+
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		if fields[0] == "a" || fields[0] == "an" {
+			n, err = 1, nil
+		}
+		if err != nil || n < 0 {
+			return time.Time{}, false
+		}
+		switch strings.TrimSuffix(fields[1], "s") {
+		case "day":
+			return today.AddDate(0, 0, -n), true
+		case "week":
+			return today.AddDate(0, 0, -7*n), true
+		case "month":
+			return today.AddDate(0, -n, 0), true
+		case "year":
+			return today.AddDate(-n, 0, 0), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func validDateAction(_ context.Context, _ *cli.Command, s string) error {
+	_, err := parseDate(s)
+	return err
+}
+
+// the date given to the flag name, or now if it is not set
+func flagDate(c *cli.Command, name string) (time.Time, error) {
+	if !c.IsSet(name) {
+		return time.Now(), nil
+	}
+	return parseDate(c.String(name))
+}
+
+// like flagDate but prints what the date resolved to, used before writing a
+// date so a relative date can be checked
+func flagDateEcho(c *cli.Command, name string) (time.Time, error) {
+	t, err := flagDate(c, name)
+	if err == nil && c.IsSet(name) {
+		fmt.Fprintf(os.Stderr, "INFO: %s '%s' is %s\n", name, c.String(name), t.Format("Mon 2006-01-02 15:04 MST"))
+	}
+	return t, err
+}
+
+// parses a duration like 30d, 2w, 1w3d or 12h, used for filtering on how
+// long a book took
+func parseTook(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	rest := strings.ToLower(strings.TrimSpace(s))
+	if rest == "" {
+		return 0, errors.New("a duration must be provided, like 30d, 2w or 1w3d")
+	}
+
+	var total time.Duration
+	for rest != "" {
+		end := 0
+		for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+			end++
+		}
+		if end == 0 || end == len(rest) || units[rest[end]] == 0 {
+			return 0, fmt.Errorf("'%s' is not a valid duration, use a number followed by h, d or w like 30d, 2w or 1w3d", s)
+		}
+		n, err := strconv.Atoi(rest[:end])
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid duration: %w", s, err)
+		}
+		total += time.Duration(n) * units[rest[end]]
+		rest = rest[end+1:]
+	}
+	return total, nil
+}
+
+func validTookAction(_ context.Context, _ *cli.Command, s string) error {
+	_, err := parseTook(s)
+	return err
+}
+
+// dates are stored as RFC 3339 with the offset they were entered in, a zero
+// time is stored as NULL
+func storedTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
+
+func parseStoredTime(s sql.NullString) (time.Time, error) {
+	if !s.Valid || s.String == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s.String)
+}
+
+// the time between start and end as it reads on a wall clock in local time,
+// so starting and finishing at the same time of day is always a whole number
+// of days, even if there was a daylight saving change in between
+func wallClockSub(end, start time.Time) time.Duration {
+	s, e := start.In(time.Local), end.In(time.Local)
+	wallStart := time.Date(s.Year(), s.Month(), s.Day(), s.Hour(), s.Minute(), s.Second(), s.Nanosecond(), time.UTC)
+	wallEnd := time.Date(e.Year(), e.Month(), e.Day(), e.Hour(), e.Minute(), e.Second(), e.Nanosecond(), time.UTC)
+	return wallEnd.Sub(wallStart)
+}
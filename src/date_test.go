@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// sets the local timezone for the rest of the test, so daylight saving falls
+// on known days
+func setLocal(t *testing.T, name string) {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = old })
+}
+
+func TestParseDateFrom(t *testing.T) {
+	setLocal(t, "America/New_York")
+	// a wednesday, after the clocks went forward on the 8th
+	now := time.Date(2026, time.March, 11, 15, 30, 0, 0, time.Local)
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		input string
+		want  time.Time
+		ok    bool
+	}{
+		{input: "2026-03-01", want: day(2026, time.March, 1), ok: true},
+		{input: "2026-03-01T10:30", want: time.Date(2026, time.March, 1, 10, 30, 0, 0, time.Local), ok: true},
+		{input: "2026-03-01 10:30:15", want: time.Date(2026, time.March, 1, 10, 30, 15, 0, time.Local), ok: true},
+		{input: "2026-03-01t10:30:00z", want: time.Date(2026, time.March, 1, 10, 30, 0, 0, time.UTC), ok: true},
+		{input: "2026-02", want: day(2026, time.February, 1), ok: true},
+		{input: "Mar 3 2025", want: day(2025, time.March, 3), ok: true},
+		{input: "march 3, 2025", want: day(2025, time.March, 3), ok: true},
+		{input: "3 MARCH 2025", want: day(2025, time.March, 3), ok: true},
+		{input: "now", want: now, ok: true},
+		{input: "today", want: day(2026, time.March, 11), ok: true},
+		{input: "  Yesterday ", want: day(2026, time.March, 10), ok: true},
+		{input: "last friday", want: day(2026, time.March, 6), ok: true},
+		// the same weekday as today is a week ago, not today
+		{input: "last wed", want: day(2026, time.March, 4), ok: true},
+		{input: "3 days ago", want: day(2026, time.March, 8), ok: true},
+		{input: "a week ago", want: day(2026, time.March, 4), ok: true},
+		{input: "2 months ago", want: day(2026, time.January, 11), ok: true},
+		{input: "1 year ago", want: day(2025, time.March, 11), ok: true},
+		// without a year it is the most recent one, which can be today
+		{input: "mar 11", want: day(2026, time.March, 11), ok: true},
+		{input: "3 march", want: day(2026, time.March, 3), ok: true},
+		{input: "oct 3", want: day(2025, time.October, 3), ok: true},
+		{input: ""},
+		{input: "tomorrow"},
+		{input: "last someday"},
+		{input: "-1 days ago"},
+		{input: "3 fortnights ago"},
+		{input: "2026-13-01"},
+		{input: "feb 30"},
+	}
+
+	for _, test := range tests {
+		got, err := parseDateFrom(test.input, now)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("parseDateFrom(%q) = %v, want an error", test.input, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("parseDateFrom(%q) = %v, %v, want %v", test.input, got, err, test.want)
+		}
+	}
+}
+
+func TestParseTook(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+		ok    bool
+	}{
+		{input: "30d", want: 30 * 24 * time.Hour, ok: true},
+		{input: "2w", want: 14 * 24 * time.Hour, ok: true},
+		{input: "1w3d", want: 10 * 24 * time.Hour, ok: true},
+		{input: "12h", want: 12 * time.Hour, ok: true},
+		{input: " 1D12H ", want: 36 * time.Hour, ok: true},
+		{input: ""},
+		{input: "d"},
+		{input: "30"},
+		{input: "30m"},
+		{input: "3d2"},
+		{input: "-3d"},
+	}
+
+	for _, test := range tests {
+		got, err := parseTook(test.input)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("parseTook(%q) = %v, want an error", test.input, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseTook(%q) = %v, %v, want %v", test.input, got, err, test.want)
+		}
+	}
+}
+
+func TestWallClockSub(t *testing.T) {
+	setLocal(t, "America/New_York")
+	local := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       time.Duration
+	}{
+		{"same day", local(time.January, 5, 9), local(time.January, 5, 17), 8 * time.Hour},
+		// the clocks go forward on march 8, so only 23 hours really pass
+		{"spring forward", local(time.March, 7, 20), local(time.March, 8, 20), 24 * time.Hour},
+		// and back on november 1, where 25 hours pass
+		{"fall back", local(time.October, 31, 9), local(time.November, 1, 9), 24 * time.Hour},
+		{"across both", local(time.March, 1, 12), local(time.November, 1, 12), 245 * 24 * time.Hour},
+		// a time stored with another offset is read in local time
+		{"other offset", time.Date(2026, time.March, 8, 1, 0, 0, 0, time.UTC), local(time.March, 8, 20), 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := wallClockSub(test.end, test.start); got != test.want {
+			t.Errorf("%s: wallClockSub(%v, %v) = %v, want %v", test.name, test.end, test.start, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+const BOOK_COLUMNS = "id, isbn, isbn_original, author, title, series, series_position, date_started, date_finished, status, genres, cover_path, rating, review, pages"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scans a row selected with BOOK_COLUMNS
+func scanBook(row scanner) (Book, error) {
+	var id int64
+	var status int
+	var date_started, date_finished sql.NullString
+	var isbn, isbnOriginal, series, genres, coverPath, review sql.NullString
+	var title, author string
+	var seriesPosition sql.NullFloat64
+	var rating, pages sql.NullInt64
+	err := row.Scan(&id, &isbn, &isbnOriginal, &author, &title, &series, &seriesPosition, &date_started, &date_finished, &status, &genres, &coverPath, &rating, &review, &pages)
+	if err != nil {
+		return Book{}, err
+	}
+
+	started, err := parseStoredTime(date_started)
+	if err != nil {
+		return Book{}, err
+	}
+	finished, err := parseStoredTime(date_finished)
+	if err != nil {
+		return Book{}, err
+	}
+
+	book := Book{
+		ID:             id,
+		ISBN:           isbn.String,
+		ISBNOriginal:   isbnOriginal.String,
+		Author:         author,
+		Title:          title,
+		Series:         series.String,
+		SeriesPosition: seriesPosition.Float64,
+		Started:        started,
+		Finished:       finished,
+		Status:         BookState(status),
+		Took:           bookTook(BookState(status), started, finished, time.Now()),
+		CoverPath:      coverPath.String,
+		Rating:         int(rating.Int64),
+		Review:         review.String,
+		Pages:          int(pages.Int64),
+	}
+	if genres.String != "" {
+		book.Genres = strings.Split(genres.String, ",")
+	}
+	return book, nil
+}
+
+// a set of conditions on the books table, they are all ANDed together.
+// Took depends on the current time so it is filtered after the query, zero
+// means no limit
+type bookFilter struct {
+	where        []string
+	args         []any
+	tookMoreThan time.Duration
+	tookLessThan time.Duration
+}
+
+func (f *bookFilter) matchTook(book Book) bool {
+	if f.tookMoreThan > 0 && book.Took <= f.tookMoreThan {
+		return false
+	}
+	// books that have not been started did not take any time
+	if f.tookLessThan > 0 && (book.Took == 0 || book.Took >= f.tookLessThan) {
+		return false
+	}
+	return true
+}
+
+func (f *bookFilter) add(where string, args ...any) {
+	f.where = append(f.where, where)
+	f.args = append(f.args, args...)
+}
+
+func (f *bookFilter) sql() (string, []any) {
+	if len(f.where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(f.where, " AND "), f.args
+}
+
+// builds a filter out of the flags used by `list`, flags that are not set
+// are ignored. started and finished match books started/finished on or after
+// the given date, --where is ANDed with the rest
+func filterFromFlags(c *cli.Command) (bookFilter, error) {
+	filter := bookFilter{}
+	if c.IsSet("isbn") {
+		isbn := canonicalISBN(c.String("isbn"))
+		filter.add("isbn = ?", isbn)
+	}
+	if c.IsSet("title") {
+		filter.add("title_key LIKE ?", "%"+normaliseName(c.String("title"))+"%")
+	}
+	if c.IsSet("author") {
+		filter.add(AUTHOR_MATCH, "%"+normaliseName(c.String("author"))+"%")
+	}
+	if c.IsSet("series") {
+		filter.add("series_key LIKE ?", "%"+normaliseName(c.String("series"))+"%")
+	}
+	if c.IsSet("state") {
+		state, err := parseBookState(c.String("state"))
+		if err != nil {
+			return bookFilter{}, err
+		}
+		filter.add("status = ?", state)
+	}
+	// dates can have different offsets so they have to be compared as unix times
+	if c.IsSet("started") {
+		started, err := flagDate(c, "started")
+		if err != nil {
+			return bookFilter{}, err
+		}
+		filter.add("unixepoch(date_started) >= ?", started.Unix())
+	}
+	if c.IsSet("finished") {
+		finished, err := flagDate(c, "finished")
+		if err != nil {
+			return bookFilter{}, err
+		}
+		filter.add("unixepoch(date_finished) >= ?", finished.Unix())
+	}
+	for _, genre := range c.StringSlice("genres") {
+		filter.add("(',' || genres || ',') LIKE ?", "%,"+strings.ToLower(genre)+",%")
+	}
+	if c.IsSet("where") {
+		where, args, err := parseWhere(c.String("where"))
+		if err != nil {
+			return bookFilter{}, err
+		}
+		filter.add("("+where+")", args...)
+	}
+	if c.IsSet("took-more-than") {
+		took, err := parseTook(c.String("took-more-than"))
+		if err != nil {
+			return bookFilter{}, err
+		}
+		filter.tookMoreThan = took
+	}
+	if c.IsSet("took-less-than") {
+		took, err := parseTook(c.String("took-less-than"))
+		if err != nil {
+			return bookFilter{}, err
+		}
+		filter.tookLessThan = took
+	}
+	return filter, nil
+}
+
+func queryBooks(db *sql.DB, filter bookFilter) ([]Book, error) {
+	where, args := filter.sql()
+	rows, err := db.Query("SELECT "+BOOK_COLUMNS+" FROM books"+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []Book{}
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		if filter.matchTook(book) {
+			books = append(books, book)
+		}
+	}
+	return books, rows.Err()
+}
+
+var SORT_KEYS = []string{"id", "title", "author", "series", "started", "finished", "took"}
+
+// returns a comparison for slices.SortStableFunc ordering books by key, text
+// is compared normalised so casing and a leading "the" do not matter
+func bookCompare(key string) (func(a, b Book) int, error) {
+	switch key {
+	case "id":
+		return func(a, b Book) int { return cmp.Compare(a.ID, b.ID) }, nil
+	case "title":
+		return func(a, b Book) int { return strings.Compare(normaliseTitle(a.Title), normaliseTitle(b.Title)) }, nil
+	case "author":
+		return func(a, b Book) int { return strings.Compare(normaliseName(a.Author), normaliseName(b.Author)) }, nil
+	case "series":
+		return func(a, b Book) int {
+			return cmp.Or(strings.Compare(normaliseTitle(a.Series), normaliseTitle(b.Series)), cmp.Compare(a.SeriesPosition, b.SeriesPosition))
+		}, nil
+	case "started":
+		return func(a, b Book) int { return a.Started.Compare(b.Started) }, nil
+	case "finished":
+		return func(a, b Book) int { return a.Finished.Compare(b.Finished) }, nil
+	case "took":
+		return func(a, b Book) int { return cmp.Compare(a.Took, b.Took) }, nil
+	default:
+		return nil, fmt.Errorf("'%s' is not a valid sort key, must be one of '%s'", key, strings.Join(SORT_KEYS, "' '"))
+	}
+}
+
+// returns the book matching either the isbn or the title and author
+func getBook(db *sql.DB, isbnSet bool, title, author, isbn string) (Book, error) {
+	filter := bookFilter{}
+	if isbnSet {
+		filter.add("isbn = ?", isbn)
+	} else {
+		filter.add("title_key = ? AND author_key = ?", normaliseName(title), normaliseName(author))
+	}
+
+	books, err := queryBooks(db, filter)
+	if err != nil {
+		return Book{}, err
+	}
+	if len(books) == 0 {
+		if isbnSet {
+			return Book{}, fmt.Errorf("book with isbn: '%s' does not exist", isbn)
+		}
+		return Book{}, fmt.Errorf("book with title: '%s' and author: '%s' does not exist", title, author)
+	}
+	return books[0], nil
+}
+
+// runs the statements in a transaction
+func execAll(db *sql.DB, statements ...func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if err := statement(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func execStmt(query string, args ...any) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, args...)
+		return err
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// provider subjects can be very noisy so only keep the first few
+const MAX_ENRICH_GENRES = 5
+
+type enrichResult struct {
+	ID        int64    `json:"id"`
+	Title     string   `json:"title"`
+	Author    string   `json:"author"`
+	Provider  string   `json:"provider,omitempty"`
+	ISBN      string   `json:"isbn,omitempty"`
+	Genres    []string `json:"genres,omitempty"`
+	Pages     int      `json:"pages,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty"`
+	err       error
+}
+
+func (r *enrichResult) hasChanges() bool {
+	return r.ISBN != "" || len(r.Genres) > 0 || r.Pages > 0
+}
+
+// turns results that propose the same isbn into conflicts, as only one book
+// can have it and there is no telling which
+func dedupeISBNs(results []enrichResult) {
+	proposed := map[string][]int{}
+	for ix, result := range results {
+		if result.ISBN != "" && len(result.Conflicts) == 0 {
+			isbn := canonicalISBN(result.ISBN)
+			proposed[isbn] = append(proposed[isbn], ix)
+		}
+	}
+	for isbn, ixs := range proposed {
+		if len(ixs) < 2 {
+			continue
+		}
+		for _, ix := range ixs {
+			others := []string{}
+			for _, other := range ixs {
+				if other != ix {
+					others = append(others, "'"+results[other].Title+"'")
+				}
+			}
+			results[ix].Conflicts = append(results[ix].Conflicts,
+				fmt.Sprintf("isbn '%s' was also found for %s", isbn, strings.Join(others, ", ")))
+		}
+	}
+}
+
+// tries each provider in turn and returns the first result that matches book
+func findMetadata(db *sql.DB, offline bool, providers []*provider, book Book) (*Metadata, error) {
+	var lastErr error
+	for _, p := range providers {
+		var found []Metadata
+		var err error
+		if book.ISBN != "" {
+			found, err = lookupISBN(db, offline, p, book.ISBN)
+		} else {
+			found, err = lookupQuery(db, offline, p, book.Title+" "+book.Author)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		// an isbn is exact so the first hit is the book, a query has to be
+		// checked against the title and author
+		if book.ISBN != "" && len(found) > 0 {
+			return &found[0], nil
+		}
+		for _, meta := range found {
+			if !strings.EqualFold(meta.Title, book.Title) {
+				continue
+			}
+			if slices.ContainsFunc(meta.Authors, func(a string) bool { return strings.EqualFold(a, book.Author) }) {
+				return &meta, nil
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// prefers an isbn 13 over an isbn 10
+func pickISBN(isbns []string) string {
+	picked := ""
+	for _, isbn := range isbns {
+		isbn = cleanISBN(isbn)
+		if !validISBN(isbn) {
+			continue
+		}
+		if len(isbn) == 13 {
+			return isbn
+		}
+		if picked == "" {
+			picked = isbn
+		}
+	}
+	return picked
+}
+
+func cleanGenres(genres []string) []string {
+	cleaned := []string{}
+	for _, genre := range genres {
+		// genres are stored comma separated so split any subjects like 'fiction, fantasy'
+		for part := range strings.SplitSeq(genre, ",") {
+			part = strings.ToLower(strings.TrimSpace(part))
+			if part == "" || slices.Contains(cleaned, part) {
+				continue
+			}
+			cleaned = append(cleaned, part)
+			if len(cleaned) == MAX_ENRICH_GENRES {
+				return cleaned
+			}
+		}
+	}
+	return cleaned
+}
+
+func proposeEnrichment(db *sql.DB, book Book, meta *Metadata) (enrichResult, error) {
+	result := enrichResult{ID: book.ID, Title: book.Title, Author: book.Author, Provider: meta.Provider}
+
+	if !strings.EqualFold(meta.Title, book.Title) {
+		result.Conflicts = append(result.Conflicts,
+			fmt.Sprintf("title '%s' differs from %s title '%s'", book.Title, meta.Provider, meta.Title))
+		return result, nil
+	}
+
+	if book.ISBN == "" {
+		isbn := pickISBN(meta.ISBNs)
+		if isbn != "" {
+			if err := isbnExists(db, canonicalISBN(isbn), false); err != nil {
+				result.Conflicts = append(result.Conflicts, err.Error())
+				return result, nil
+			}
+			result.ISBN = isbn
+		}
+	}
+
+	if len(book.Genres) == 0 {
+		result.Genres = cleanGenres(meta.Genres)
+	}
+	if book.Pages == 0 {
+		result.Pages = meta.Pages
+	}
+	return result, nil
+}
+
+// only fills in what is still missing, the book may have been changed since
+// the result was proposed. a book is updated all at once or not at all
+func applyEnrichment(db *sql.DB, result enrichResult) error {
+	statements := []func(tx *sql.Tx) error{}
+	if result.ISBN != "" {
+		statements = append(statements, execStmt("UPDATE books SET isbn = ?, isbn_original = ? WHERE id = ? AND COALESCE(isbn, '') = ''",
+			canonicalISBN(result.ISBN), result.ISBN, result.ID))
+	}
+	if len(result.Genres) > 0 {
+		statements = append(statements, execStmt("UPDATE books SET genres = ? WHERE id = ? AND COALESCE(genres, '') = ''",
+			strings.Join(result.Genres, ","), result.ID))
+	}
+	if result.Pages > 0 {
+		statements = append(statements, execStmt("UPDATE books SET pages = ? WHERE id = ? AND COALESCE(pages, 0) = 0",
+			result.Pages, result.ID))
+	}
+	return execAll(db, statements...)
+}
+
+// the page count of book from the metadata providers, for add --lookup. 0 if
+// it is not found, a failed lookup only warns as the book can be added anyway
+func lookupPages(db *sql.DB, c *cli.Command, cfg config, book Book) int {
+	providers, err := providersFromFlag(c, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARN: could not look up the pages of '%s': %s\n", book.Title, err)
+		return 0
+	}
+	meta, err := findMetadata(db, c.Bool("offline"), providers, book)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "WARN: could not look up the pages of '%s': %s\n", book.Title, err)
+	case meta == nil || meta.Pages == 0:
+		fmt.Fprintf(os.Stderr, "WARN: no page count was found for '%s'\n", book.Title)
+	default:
+		fmt.Fprintf(os.Stderr, "INFO: '%s' has %d pages according to %s\n", book.Title, meta.Pages, meta.Provider)
+		return meta.Pages
+	}
+	return 0
+}
+
+// --provider if it is set, otherwise the configured providers
+func providersFromFlag(c *cli.Command, cfg config) ([]*provider, error) {
+	names := cfg.defaults.providers
+	if c.IsSet("provider") {
+		names = c.StringSlice("provider")
+	}
+
+	providers := []*provider{}
+	for _, name := range names {
+		p, ok := PROVIDERS[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("'%s' is not a metadata provider, must be one of 'openlibrary' 'google'", name)
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+func applyReviewFile(db *sql.DB, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var results []enrichResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		return fmt.Errorf("'%s' is not a valid review file: %w", path, err)
+	}
+
+	// the file may have been edited, or the books changed since it was written
+	dedupeISBNs(results)
+	applied := 0
+	for _, result := range results {
+		if len(result.Conflicts) > 0 && result.hasChanges() {
+			fmt.Fprintf(os.Stderr, "WARN: skipping '%s': %s\n", result.Title, strings.Join(result.Conflicts, "; "))
+		}
+		if len(result.Conflicts) > 0 || !result.hasChanges() {
+			continue
+		}
+		if result.ISBN != "" {
+			if err := isbnExists(db, canonicalISBN(result.ISBN), false); err != nil {
+				fmt.Fprintf(os.Stderr, "WARN: skipping '%s': %s\n", result.Title, err)
+				continue
+			}
+		}
+		if err := applyEnrichment(db, result); err != nil {
+			return err
+		}
+		applied++
+	}
+	fmt.Printf("applied changes to %d books from '%s'\n", applied, path)
+	return nil
+}
+
+var enrichFlags = append(slices.Clone(listFlags),
+	&cli.IntFlag{
+		Name:  "workers",
+		Usage: "the max `number` of lookups to run at once",
+		Value: 4,
+	},
+	&cli.FloatFlag{
+		Name:  "rate",
+		Usage: "the max number of `lookups` per second",
+		Value: 2,
+	},
+	&cli.StringSliceFlag{
+		Name:  "provider",
+		Usage: "the metadata `providers` to try in order",
+	},
+	&cli.StringFlag{
+		Name:      "review",
+		Usage:     "the `file` to write proposed changes to",
+		Value:     "enrich-review.json",
+		TakesFile: true,
+	},
+	&cli.StringFlag{
+		Name:      "apply",
+		Usage:     "apply the proposed changes in a reviewed `file`",
+		TakesFile: true,
+	},
+	&cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		Usage:   "apply proposed changes straight away instead of writing a review file",
+	},
+)
+
+var enrichCmd = &cli.Command{
+	Name:  "enrich",
+	Usage: "fill in missing isbns, genres and page counts using the metadata providers",
+	Description: "series are not filled in, openlibrary's search results do not have them and google only\n" +
+		"gives an id for a series, not its name. set them with `update --series`",
+	Flags: enrichFlags,
+	Action: func(ctx context.Context, c *cli.Command) error {
+		db := ctx.Value(myCtx{}).(*sql.DB)
+
+		if c.IsSet("apply") {
+			return applyReviewFile(db, c.String("apply"))
+		}
+
+		workers, rate := c.Int("workers"), c.Float("rate")
+		if workers < 1 {
+			return errors.New("workers must be at least 1")
+		}
+		if rate <= 0 {
+			return errors.New("rate must be greater than 0")
+		}
+		providers, err := providersFromFlag(c, ctx.Value(configCtx{}).(config))
+		if err != nil {
+			return err
+		}
+
+		filter, err := filterFromFlags(c)
+		if err != nil {
+			return err
+		}
+		books, err := queryBooks(db, filter)
+		if err != nil {
+			return err
+		}
+
+		limiter := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer limiter.Stop()
+
+		jobs := make(chan int)
+		results := make([]enrichResult, len(books))
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Go(func() {
+				for ix := range jobs {
+					<-limiter.C
+					book := books[ix]
+					meta, err := findMetadata(db, c.Bool("offline"), providers, book)
+					if err != nil || meta == nil {
+						results[ix] = enrichResult{ID: book.ID, Title: book.Title, Author: book.Author, err: err}
+						continue
+					}
+					results[ix], err = proposeEnrichment(db, book, meta)
+					results[ix].err = err
+				}
+			})
+		}
+		for ix := range books {
+			jobs <- ix
+		}
+		close(jobs)
+		wg.Wait()
+		dedupeISBNs(results)
+
+		proposed := []enrichResult{}
+		found, missed, conflicts, unchanged := 0, 0, 0, 0
+		for _, result := range results {
+			switch {
+			case result.Provider == "" || result.err != nil:
+				// one failed lookup should not throw away the rest of the run
+				missed++
+				if result.err != nil {
+					fmt.Printf("miss     %s: %s\n", result.Title, result.err)
+				} else {
+					fmt.Printf("miss     %s\n", result.Title)
+				}
+			case len(result.Conflicts) > 0:
+				conflicts++
+				fmt.Printf("conflict %s: %s\n", result.Title, strings.Join(result.Conflicts, "; "))
+				proposed = append(proposed, result)
+			case result.hasChanges():
+				found++
+				changes := []string{}
+				if result.ISBN != "" {
+					changes = append(changes, "isbn "+result.ISBN)
+				}
+				if len(result.Genres) > 0 {
+					changes = append(changes, "genres "+strings.Join(result.Genres, ","))
+				}
+				if result.Pages > 0 {
+					changes = append(changes, fmt.Sprintf("%d pages", result.Pages))
+				}
+				fmt.Printf("found    %s (%s): %s\n", result.Title, result.Provider, strings.Join(changes, ", "))
+				proposed = append(proposed, result)
+			default:
+				unchanged++
+			}
+		}
+		fmt.Printf("\n%d found, %d missed, %d conflicts, %d already complete\n", found, missed, conflicts, unchanged)
+
+		if c.Bool("yes") {
+			for _, result := range proposed {
+				if len(result.Conflicts) > 0 {
+					continue
+				}
+				if err := applyEnrichment(db, result); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("applied changes to %d books\n", found)
+			return nil
+		}
+
+		if len(proposed) == 0 {
+			return nil
+		}
+		data, err := json.MarshalIndent(proposed, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(c.String("review"), data, 0666); err != nil {
+			return err
+		}
+		fmt.Printf("wrote proposed changes to '%s', apply them with `enrich --apply %s`\n", c.String("review"), c.String("review"))
+		return nil
+	},
+}
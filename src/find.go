@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// books_fts is an fts5 table over books with a column for each books quotes.
+// it keeps its own copy of the text, as the quotes are not a column of books,
+// and the triggers keep it in sync. needs the sqlite_fts5 build tag, without
+// it ensureSearchIndex drops the triggers and find falls back to LIKE
+var CREATESEARCHQUERIES = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS books_fts USING fts5(
+		title, author, series, genres, review, quotes,
+		tokenize = 'unicode61 remove_diacritics 2'
+	);`,
+	`CREATE TRIGGER IF NOT EXISTS books_fts_insert AFTER INSERT ON books BEGIN
+		INSERT INTO books_fts (rowid, title, author, series, genres, review, quotes)
+		VALUES (new.id, new.title, new.author, new.series, new.genres, new.review, ` + BOOK_QUOTES + `);
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS books_fts_delete AFTER DELETE ON books BEGIN
+		DELETE FROM books_fts WHERE rowid = old.id;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS books_fts_update AFTER UPDATE ON books BEGIN
+		DELETE FROM books_fts WHERE rowid = old.id;
+		INSERT INTO books_fts (rowid, title, author, series, genres, review, quotes)
+		VALUES (new.id, new.title, new.author, new.series, new.genres, new.review, ` + BOOK_QUOTES + `);
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS books_fts_quotes_insert AFTER INSERT ON quotes BEGIN
+		UPDATE books_fts SET quotes = ` + strings.ReplaceAll(BOOK_QUOTES, "new.id", "new.book_id") + ` WHERE rowid = new.book_id;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS books_fts_quotes_delete AFTER DELETE ON quotes BEGIN
+		UPDATE books_fts SET quotes = ` + strings.ReplaceAll(BOOK_QUOTES, "new.id", "old.book_id") + ` WHERE rowid = old.book_id;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS books_fts_quotes_update AFTER UPDATE ON quotes BEGIN
+		UPDATE books_fts SET quotes = ` + strings.ReplaceAll(BOOK_QUOTES, "new.id", "old.book_id") + ` WHERE rowid = old.book_id;
+		UPDATE books_fts SET quotes = ` + strings.ReplaceAll(BOOK_QUOTES, "new.id", "new.book_id") + ` WHERE rowid = new.book_id;
+	END;`,
+}
+
+// the quotes of the book new.id as one text
+const BOOK_QUOTES = "(SELECT group_concat(text, ' / ') FROM quotes WHERE book_id = new.id)"
+
+// the columns of books_fts, a search term can be limited to one with column:term
+var SEARCH_COLUMNS = []string{"title", "author", "series", "genres", "review", "quotes"}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+const NO_SEARCH = "full text search is not available, build with '-tags sqlite_fts5'"
+
+// whether sqlite was built with fts5, see the sqlite_fts5 build tag
+func searchAvailable(db *sql.DB) bool {
+	var used bool
+	err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used)
+	return err == nil && used
+}
+
+// creates books_fts and any of its triggers that are missing, then indexes
+// every book
+func createSearchIndex(db execer) error {
+	for _, query := range CREATESEARCHQUERIES {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return rebuildSearchIndex(db)
+}
+
+// keeps the search index in step with the build. with fts5 the index is
+// created, or made again if a build without fts5 or a migration dropped its
+// triggers. without it the triggers are dropped, as every write to books would
+// fail on them, which leaves the missing triggers as the record that the index
+// is stale
+func ensureSearchIndex(db *sql.DB) error {
+	triggers, err := searchTriggers(db)
+	if err != nil {
+		return err
+	}
+	search := searchAvailable(db)
+	if (!search && len(triggers) == 0) || (search && len(triggers) == len(CREATESEARCHQUERIES)-1) {
+		return nil
+	}
+
+	statements := []func(tx *sql.Tx) error{}
+	for _, name := range triggers {
+		statements = append(statements, execStmt("DROP TRIGGER "+name))
+	}
+	if search {
+		// the table is made again too in case its columns changed
+		statements = append(statements,
+			execStmt("DROP TABLE IF EXISTS books_fts"),
+			func(tx *sql.Tx) error { return createSearchIndex(tx) },
+		)
+	}
+	return execAll(db, statements...)
+}
+
+func searchTriggers(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'books_fts_%'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func rebuildSearchIndex(db execer) error {
+	if _, err := db.Exec("DELETE FROM books_fts"); err != nil {
+		return err
+	}
+	_, err := db.Exec(`INSERT INTO books_fts (rowid, title, author, series, genres, review, quotes)
+		SELECT id, title, author, series, genres, review, ` + strings.ReplaceAll(BOOK_QUOTES, "new.id", "books.id") + ` FROM books`)
+	return err
+}
+
+// turns what was typed into an fts5 query. words are matched as they are so
+// punctuation can not cause a syntax error, "quoted words" are a phrase, a
+// trailing * is a prefix search, column:word searches one column and AND, OR
+// and NOT are passed through
+func searchQuery(input string) (string, error) {
+	terms := []string{}
+	rest := strings.TrimSpace(input)
+	for rest != "" {
+		column := ""
+		if name, after, found := strings.Cut(rest, ":"); found && !strings.ContainsAny(name, " \"") {
+			if !slices.Contains(SEARCH_COLUMNS, name) {
+				return "", fmt.Errorf("'%s' is not a column that can be searched, must be one of '%s'", name, strings.Join(SEARCH_COLUMNS, "' '"))
+			}
+			column, rest = name, after
+		}
+
+		var term string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.Index(rest[1:], "\"")
+			if end == -1 {
+				return "", fmt.Errorf("unterminated phrase in '%s'", input)
+			}
+			term, rest = rest[1:end+1], rest[end+2:]
+			// a * after the closing quote makes the phrase a prefix search
+			if strings.HasPrefix(rest, "*") {
+				term, rest = term+"*", rest[1:]
+			}
+		} else {
+			term, rest, _ = strings.Cut(rest, " ")
+		}
+		rest = strings.TrimSpace(rest)
+
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.TrimSuffix(term, "*")
+		if column == "" && (term == "AND" || term == "OR" || term == "NOT") {
+			terms = append(terms, term)
+			continue
+		}
+		if term == "" {
+			continue
+		}
+
+		quoted := "\"" + strings.ReplaceAll(term, "\"", "\"\"") + "\""
+		if prefix {
+			quoted += "*"
+		}
+		if column != "" {
+			quoted = column + " : " + quoted
+		}
+		terms = append(terms, quoted)
+	}
+	if len(terms) == 0 {
+		return "", errors.New("nothing to search for")
+	}
+	return strings.Join(terms, " "), nil
+}
+
+// whether stdout is a terminal that wants colour, see https://no-color.org
+func useColour() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type searchHit struct {
+	Book
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+// books matching every word of input in their title, author, series, genres,
+// review or quotes, used when there is no search index. column:word still
+// searches one column but phrases, prefixes and AND, OR and NOT are only
+// matched as words
+func likeSearchBooks(db *sql.DB, input string, limit int) ([]searchHit, error) {
+	filter := bookFilter{}
+	for _, word := range strings.Fields(strings.NewReplacer("\"", " ", "*", " ").Replace(input)) {
+		if word == "AND" || word == "OR" || word == "NOT" {
+			continue
+		}
+		columns := SEARCH_COLUMNS
+		if name, after, found := strings.Cut(word, ":"); found {
+			if !slices.Contains(SEARCH_COLUMNS, name) {
+				return nil, fmt.Errorf("'%s' is not a column that can be searched, must be one of '%s'", name, strings.Join(SEARCH_COLUMNS, "' '"))
+			}
+			columns, word = []string{name}, after
+		}
+		if word == "" {
+			continue
+		}
+
+		matches, args := []string{}, []any{}
+		for _, column := range columns {
+			switch column {
+			case "genres", "review":
+				matches = append(matches, "COALESCE("+column+", '') LIKE ?")
+				args = append(args, "%"+word+"%")
+			case "quotes":
+				matches = append(matches, "EXISTS (SELECT 1 FROM quotes WHERE quotes.book_id = books.id AND quotes.text LIKE ?)")
+				args = append(args, "%"+word+"%")
+			default:
+				matches = append(matches, column+"_key LIKE ?")
+				args = append(args, "%"+normaliseName(word)+"%")
+			}
+		}
+		filter.add("("+strings.Join(matches, " OR ")+")", args...)
+	}
+	if len(filter.where) == 0 {
+		return nil, errors.New("nothing to search for")
+	}
+
+	books, err := queryBooks(db, filter)
+	if err != nil {
+		return nil, err
+	}
+	hits := []searchHit{}
+	for _, book := range books[:min(limit, len(books))] {
+		hits = append(hits, searchHit{Book: book})
+	}
+	return hits, nil
+}
+
+// books matching query best first, the snippet has the matches wrapped in
+// before and after
+func searchBooks(db *sql.DB, query string, limit int, before, after string) ([]searchHit, error) {
+	// bm25 scores are negative, lower is better. the weights favour titles
+	// and a word in a long review or the quotes counts for the least
+	const QUERY = `SELECT rowid, snippet(books_fts, -1, ?, ?, '…', 10), bm25(books_fts, 10.0, 5.0, 2.0, 1.0, 0.5, 0.5) AS score
+		FROM books_fts WHERE books_fts MATCH ? ORDER BY score LIMIT ?`
+	rows, err := db.Query(QUERY, before, after, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []searchHit{}
+	for rows.Next() {
+		var hit searchHit
+		if err := rows.Scan(&hit.ID, &hit.Snippet, &hit.Score); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for ix := range hits {
+		book, err := getBookByID(db, hits[ix].ID)
+		if err != nil {
+			return nil, err
+		}
+		hits[ix].Book = book
+	}
+	return hits, nil
+}
+
+var findCmd = &cli.Command{
+	Name:  "find",
+	Usage: "full text search over titles, authors, series, genres, reviews and quotes",
+	Description: `words are matched anywhere, "a phrase" matches words next to each other,
+drag* matches words starting with drag and author:sanderson only searches one column.
+AND, OR and NOT combine terms, words next to each other are ANDed`,
+	ArgsUsage: "QUERY",
+	Flags: []cli.Flag{
+		formatFlag,
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "show at most `n` results",
+			Value: 20,
+		},
+		&cli.BoolFlag{
+			Name:  "rebuild",
+			Usage: "rebuild the search index from scratch, then search if a query is given",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		db := ctx.Value(myCtx{}).(*sql.DB)
+		cfg := ctx.Value(configCtx{}).(config)
+
+		indexed := searchAvailable(db)
+		if c.Bool("rebuild") {
+			if !indexed {
+				return errors.New(NO_SEARCH)
+			}
+			if err := rebuildSearchIndex(db); err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, "INFO: rebuilt the search index")
+			if c.Args().Len() == 0 {
+				return nil
+			}
+		}
+
+		input := strings.Join(c.Args().Slice(), " ")
+		asJSON := outputFormat(c, cfg) == "json"
+		var hits []searchHit
+		if indexed {
+			query, err := searchQuery(input)
+			if err != nil {
+				return err
+			}
+			before, after := "[", "]"
+			if !asJSON && useColour() {
+				before, after = "\x1b[1;33m", "\x1b[0m"
+			}
+			hits, err = searchBooks(db, query, int(c.Int("limit")), before, after)
+			if err != nil {
+				return fmt.Errorf("searching for '%s': %w", query, err)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "WARN: %s, matching words with LIKE instead\n", NO_SEARCH)
+			var err error
+			if hits, err = likeSearchBooks(db, input, int(c.Int("limit"))); err != nil {
+				return err
+			}
+		}
+
+		if asJSON {
+			return printJSON(hits)
+		}
+		if len(hits) == 0 {
+			fmt.Fprintln(os.Stderr, "INFO: no books matched")
+		}
+		for _, hit := range hits {
+			fmt.Printf("%4d: %s by %s (%s)\n", hit.ID, hit.Title, hit.Author, hit.Status)
+			if hit.Snippet != "" {
+				fmt.Printf("      %s\n", hit.Snippet)
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{input: "dune", want: `"dune"`, ok: true},
+		{input: "  dune   messiah ", want: `"dune" "messiah"`, ok: true},
+		// punctuation is part of the word, not fts5 syntax
+		{input: "o'brien c++", want: `"o'brien" "c++"`, ok: true},
+		{input: `"the name of the wind"`, want: `"the name of the wind"`, ok: true},
+		{input: "sand*", want: `"sand"*`, ok: true},
+		{input: `"stormlight arch"*`, want: `"stormlight arch"*`, ok: true},
+		{input: "author:gaiman", want: `author : "gaiman"`, ok: true},
+		{input: `title:"good omens" quotes:wise*`, want: `title : "good omens" quotes : "wise"*`, ok: true},
+		{input: "dune OR mort", want: `"dune" OR "mort"`, ok: true},
+		{input: "fantasy NOT author:sanderson", want: `"fantasy" NOT author : "sanderson"`, ok: true},
+		{input: "fantasy AND humour", want: `"fantasy" AND "humour"`, ok: true},
+		// only upper case operators are operators
+		{input: "war and peace", want: `"war" "and" "peace"`, ok: true},
+		{input: "title:OR", want: `title : "OR"`, ok: true},
+		{input: `say "hi" there`, want: `"say" "hi" "there"`, ok: true},
+		{input: ""},
+		{input: "   "},
+		{input: `""`},
+		{input: "publisher:tor"},
+		{input: `"unterminated phrase`},
+	}
+
+	for _, test := range tests {
+		got, err := searchQuery(test.input)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("searchQuery(%q) = %q, want an error", test.input, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("searchQuery(%q) = %q, %v, want %q", test.input, got, err, test.want)
+		}
+	}
+}
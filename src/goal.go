@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// the part of the year that has to have gone before the pace so far is used
+// to project the end of the year, before that one book is a wild guess
+const GOAL_PROJECT_AFTER = 1.0 / 12
+
+// how many books, and optionally pages, are wanted in a year
+type goalTarget struct {
+	Books int
+	// 0 without a pages target
+	Pages int
+}
+
+// how many books are wanted each year and how far along that is
+type goalStatus struct {
+	Year     int `json:"year"`
+	Target   int `json:"target"`
+	Finished int `json:"finished"`
+	// how many should be finished by today to be on pace
+	Expected float64 `json:"expected"`
+	// how many the current rate gets to by the end of the year, nil when it
+	// is too early in the year to tell
+	Projected *int `json:"projected"`
+	// the same for the pages of the finished books, only with a pages target
+	PagesTarget    int     `json:"pages_target,omitempty"`
+	Pages          int     `json:"pages,omitempty"`
+	PagesExpected  float64 `json:"pages_expected,omitempty"`
+	PagesProjected *int    `json:"pages_projected,omitempty"`
+	// the part of the year that has gone, from 0 to 1
+	Elapsed float64 `json:"elapsed"`
+}
+
+func getGoal(db *sql.DB, year int) (goalTarget, error) {
+	var target goalTarget
+	var pages sql.NullInt64
+	err := db.QueryRow("SELECT books, pages FROM goals WHERE year = ?", year).Scan(&target.Books, &pages)
+	if errors.Is(err, sql.ErrNoRows) {
+		return goalTarget{}, fmt.Errorf("there is no goal for %d, set one with `goal set %d COUNT`", year, year)
+	}
+	target.Pages = int(pages.Int64)
+	return target, err
+}
+
+// how far along done should be by now and where it is heading
+func goalPace(done, target int, elapsed float64) (float64, *int) {
+	expected := math.Round(float64(target)*elapsed*10) / 10
+	if elapsed < GOAL_PROJECT_AFTER {
+		return expected, nil
+	}
+	projected := int(math.Round(float64(done) / elapsed))
+	return expected, &projected
+}
+
+// where the goal for year is at now
+func computeGoal(db *sql.DB, year int, target goalTarget, now time.Time) (goalStatus, error) {
+	books, err := statsBooks(db, year)
+	if err != nil {
+		return goalStatus{}, err
+	}
+	status := goalStatus{Year: year, Target: target.Books, PagesTarget: target.Pages}
+	for _, book := range books {
+		if book.Status == BS_FINISHED {
+			status.Finished++
+			status.Pages += book.Pages
+		}
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(1, 0, 0)
+	switch {
+	case now.Before(start):
+		status.Elapsed = 0
+	case !now.Before(end):
+		status.Elapsed = 1
+	default:
+		status.Elapsed = now.Sub(start).Hours() / end.Sub(start).Hours()
+	}
+	status.Expected, status.Projected = goalPace(status.Finished, status.Target, status.Elapsed)
+	if status.PagesTarget > 0 {
+		status.PagesExpected, status.PagesProjected = goalPace(status.Pages, status.PagesTarget, status.Elapsed)
+	}
+	return status, nil
+}
+
+// the pace of one target of a year that has started, unit is books or pages
+// and verb is what happens to them
+func formatPace(count, target int, expected float64, projected *int, elapsed float64, unit, verb string) string {
+	switch {
+	case elapsed == 1 && count >= target:
+		return "goal met\n"
+	case elapsed == 1:
+		return fmt.Sprintf("goal missed by %d %s\n", target-count, unit)
+	}
+
+	s := ""
+	ahead := float64(count) - expected
+	switch {
+	case math.Abs(ahead) < 0.5:
+		s += fmt.Sprintf("Pace     : on pace, %g should be %s by today\n", expected, verb)
+	case ahead > 0:
+		s += fmt.Sprintf("Pace     : %.0f ahead, %g should be %s by today\n", ahead, expected, verb)
+	default:
+		s += fmt.Sprintf("Pace     : %.0f behind, %g should be %s by today\n", -ahead, expected, verb)
+	}
+	if projected == nil {
+		s += "Projected: too early in the year to tell\n"
+	} else {
+		s += fmt.Sprintf("Projected: %d by the end of the year\n", *projected)
+	}
+	if left := target - count; left > 0 {
+		weeks := (1 - elapsed) * 52
+		s += fmt.Sprintf("Needed   : %d more, about %.1f a week\n", left, float64(left)/max(weeks, 1))
+	}
+	return s
+}
+
+func (g *goalStatus) String() string {
+	s := fmt.Sprintf("%d: %d of %d books (%.0f%%)\n", g.Year, g.Finished, g.Target, float64(g.Finished)/float64(g.Target)*100)
+	if g.Elapsed == 0 {
+		return s + "the year has not started yet\n"
+	}
+	s += formatPace(g.Finished, g.Target, g.Expected, g.Projected, g.Elapsed, "books", "finished")
+	if g.PagesTarget > 0 {
+		s += fmt.Sprintf("\n%d of %d pages (%.0f%%)\n", g.Pages, g.PagesTarget, float64(g.Pages)/float64(g.PagesTarget)*100)
+		s += formatPace(g.Pages, g.PagesTarget, g.PagesExpected, g.PagesProjected, g.Elapsed, "pages", "read")
+	}
+	return s
+}
+
+var goalCmd = &cli.Command{
+	Name:  "goal",
+	Usage: "set how many books, and pages, to read in a year and see how it is going",
+	Commands: []*cli.Command{
+		{
+			Name:  "set",
+			Usage: "set the goal for a year, replacing it if there already is one",
+			Arguments: []cli.Argument{
+				&cli.IntArg{Name: "year"},
+				&cli.IntArg{Name: "books"},
+			},
+			ArgsUsage: "YEAR BOOKS",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  "pages",
+					Usage: "also aim to read this many `pages`, counted from the books with a page count",
+					Action: func(_ context.Context, _ *cli.Command, n int) error {
+						if n < 1 {
+							return fmt.Errorf("'%d' is not a valid pages goal, it must be at least 1", n)
+						}
+						return nil
+					},
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				year, books := c.IntArg("year"), c.IntArg("books")
+				if year <= 0 || books <= 0 {
+					return errors.New("a year and a number of books must be provided, like: goal set 2026 40")
+				}
+
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				if _, err := getGoal(db, int(year)); err == nil {
+					fmt.Fprintf(os.Stderr, "INFO: replacing the goal for %d\n", year)
+				}
+				const QUERY = `INSERT INTO goals (year, books, pages) VALUES(?, ?, ?)
+					ON CONFLICT (year) DO UPDATE SET books = excluded.books, pages = excluded.pages`
+				_, err := db.Exec(QUERY, year, books, storedPages(c.Int("pages")))
+				return err
+			},
+		},
+		{
+			Name:      "status",
+			Usage:     "show whether you are ahead or behind a goal and where the year is heading",
+			Arguments: []cli.Argument{&cli.IntArg{Name: "year"}},
+			ArgsUsage: "[YEAR]",
+			Flags:     []cli.Flag{formatFlag},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				cfg := ctx.Value(configCtx{}).(config)
+				now := time.Now()
+				year := int(c.IntArg("year"))
+				if year == 0 {
+					year = now.Year()
+				}
+				target, err := getGoal(db, year)
+				if err != nil {
+					return err
+				}
+				status, err := computeGoal(db, year, target, now)
+				if err != nil {
+					return err
+				}
+
+				if outputFormat(c, cfg) == "json" {
+					return printJSON(status)
+				}
+				fmt.Print(status.String())
+				return nil
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "remove the goal for a year",
+			Arguments: []cli.Argument{&cli.IntArg{Name: "year"}},
+			ArgsUsage: "YEAR",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				year := int(c.IntArg("year"))
+				if _, err := getGoal(db, year); err != nil {
+					return err
+				}
+				_, err := db.Exec("DELETE FROM goals WHERE year = ?", year)
+				return err
+			},
+		},
+	},
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+type ISBNErrorKind byte
+
+const (
+	ISBN_BAD_LENGTH ISBNErrorKind = iota
+	ISBN_ILLEGAL_CHAR
+	ISBN_MISPLACED_X
+	ISBN_BAD_CHECKSUM
+)
+
+// why an isbn failed to parse
+type ISBNError struct {
+	Kind ISBNErrorKind
+	ISBN string
+	// the 1 based position of the offending character, for ISBN_ILLEGAL_CHAR
+	// and ISBN_MISPLACED_X
+	Pos  int
+	Char rune
+	// the number of digits found, for ISBN_BAD_LENGTH
+	Length int
+	// the check digit the isbn should have and the one it has, for ISBN_BAD_CHECKSUM
+	Expected byte
+	Got      byte
+}
+
+func (e *ISBNError) Error() string {
+	var reason string
+	switch e.Kind {
+	case ISBN_BAD_LENGTH:
+		reason = fmt.Sprintf("an ISBN must have 10 or 13 digits, found %d", e.Length)
+	case ISBN_ILLEGAL_CHAR:
+		reason = fmt.Sprintf("illegal character '%c' at position %d", e.Char, e.Pos)
+	case ISBN_MISPLACED_X:
+		reason = fmt.Sprintf("'X' at position %d, 'X' can only be the check digit of an ISBN-10", e.Pos)
+	case ISBN_BAD_CHECKSUM:
+		reason = fmt.Sprintf("checksum mismatch, expected check digit '%c' but found '%c'", e.Expected, e.Got)
+	}
+	return fmt.Sprintf("'%s' is not a valid ISBN: %s", e.ISBN, reason)
+}
+
+func cleanISBN(isbn string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(isbn, "-", ""), " ", "")
+}
+
+// parses an ISBN-10 or ISBN-13, dashes and spaces are allowed as separators.
+// returns the isbn without separators and with an upper case X, or an *ISBNError
+func parseISBN(isbn string) (string, error) {
+	digits := make([]byte, 0, 13)
+	xPos, xIndex := 0, 0
+	pos := 0
+	for _, r := range isbn {
+		pos++
+		switch {
+		case r == '-' || r == ' ':
+		case r >= '0' && r <= '9':
+			digits = append(digits, byte(r))
+		case r == 'x' || r == 'X':
+			// report the first X, if there are more the length or position check will catch it
+			if xPos == 0 {
+				xPos, xIndex = pos, len(digits)
+			}
+			digits = append(digits, 'X')
+		default:
+			return "", &ISBNError{Kind: ISBN_ILLEGAL_CHAR, ISBN: isbn, Pos: pos, Char: r}
+		}
+	}
+
+	if len(digits) != 10 && len(digits) != 13 {
+		return "", &ISBNError{Kind: ISBN_BAD_LENGTH, ISBN: isbn, Length: len(digits)}
+	}
+	if xPos != 0 && (len(digits) == 13 || xIndex != 9) {
+		return "", &ISBNError{Kind: ISBN_MISPLACED_X, ISBN: isbn, Pos: xPos, Char: 'X'}
+	}
+
+	values := isbnValues(string(digits))
+	var expected byte
+	if len(digits) == 10 {
+		expected = checkDigitChar(isbn10CheckDigit(values[:9]))
+	} else {
+		expected = checkDigitChar(isbn13CheckDigit(values[:12]))
+	}
+	if got := digits[len(digits)-1]; got != expected {
+		return "", &ISBNError{Kind: ISBN_BAD_CHECKSUM, ISBN: isbn, Expected: expected, Got: got}
+	}
+	return string(digits), nil
+}
+
+func validISBN(isbn string) bool {
+	_, err := parseISBN(isbn)
+	return err == nil
+}
+
+// the numeric value of each digit of a parsed isbn, X is 10
+func isbnValues(isbn string) []int {
+	values := make([]int, 0, len(isbn))
+	for _, i := range isbn {
+		if i == 'X' {
+			values = append(values, 10)
+		} else {
+			values = append(values, int(i-'0'))
+		}
+	}
+	return values
+}
+
+func checkDigitChar(digit int) byte {
+	if digit == 10 {
+		return 'X'
+	}
+	return byte('0' + digit)
+}
+
+func isbn13CheckDigit(first12 []int) int {
+	sum := 0
+	for ix, i := range first12 {
+		if ix%2 == 0 {
+			sum += i
+		} else {
+			sum += 3 * i
+		}
+	}
+	return (10 - sum%10) % 10
+}
+
+func isbn10CheckDigit(first9 []int) int {
+	sum := 0
+	for ix, i := range first9 {
+		sum += (10 - ix) * i
+	}
+	return (11 - sum%11) % 11
+}
+
+// converts a valid isbn 10 or 13 to its isbn 13 form, this is the form isbns
+// are stored in
+func toISBN13(isbn string) (string, error) {
+	parsed, err := parseISBN(isbn)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed) == 13 {
+		return parsed, nil
+	}
+
+	digits := append([]int{9, 7, 8}, isbnValues(parsed)[:9]...)
+	return "978" + parsed[:9] + string(checkDigitChar(isbn13CheckDigit(digits))), nil
+}
+
+// converts a valid isbn 10 or 13 to its isbn 10 form, only isbn 13s starting
+// with 978 have an isbn 10 form
+func toISBN10(isbn string) (string, error) {
+	parsed, err := parseISBN(isbn)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed) == 10 {
+		return parsed, nil
+	}
+	if !strings.HasPrefix(parsed, "978") {
+		return "", fmt.Errorf("'%s' does not start with 978 so it has no ISBN-10 form", isbn)
+	}
+
+	return parsed[3:12] + string(checkDigitChar(isbn10CheckDigit(isbnValues(parsed[3:12])))), nil
+}
+
+// the canonical form of an isbn, or the cleaned isbn if it can not be converted
+func canonicalISBN(isbn string) string {
+	isbn13, err := toISBN13(isbn)
+	if err != nil {
+		return cleanISBN(isbn)
+	}
+	return isbn13
+}
+
+var isbnCmd = &cli.Command{
+	Name:  "isbn",
+	Usage: "helpers for working with ISBN numbers",
+	Commands: []*cli.Command{
+		{
+			Name:      "convert",
+			Usage:     "convert an ISBN between its ISBN-10 and ISBN-13 forms",
+			Metadata:  map[string]any{SKIP_SETUP: true},
+			Arguments: []cli.Argument{&cli.StringArg{Name: "isbn"}},
+			ArgsUsage: "ISBN",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "to",
+					Usage: "only print the `form`, must be one of '10' '13'",
+					Action: func(ctx context.Context, c *cli.Command, s string) error {
+						if s != "10" && s != "13" {
+							return fmt.Errorf("'%s' is not a valid ISBN form, form must be one of '10' '13'", s)
+						}
+						return nil
+					},
+				},
+			},
+			Action: func(_ context.Context, c *cli.Command) error {
+				isbn := c.StringArg("isbn")
+				isbn13, err := toISBN13(isbn)
+				if err != nil {
+					return err
+				}
+				isbn10, err10 := toISBN10(isbn)
+
+				switch c.String("to") {
+				case "13":
+					fmt.Println(isbn13)
+				case "10":
+					if err10 != nil {
+						return err10
+					}
+					fmt.Println(isbn10)
+				default:
+					fmt.Printf("ISBN-13: %s\n", isbn13)
+					if err10 != nil {
+						fmt.Println("ISBN-10: --")
+					} else {
+						fmt.Printf("ISBN-10: %s\n", isbn10)
+					}
+				}
+				return nil
+			},
+		},
+	},
+}
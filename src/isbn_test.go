@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseISBN(t *testing.T) {
+	tests := []struct {
+		isbn string
+		want string
+		kind ISBNErrorKind
+		ok   bool
+	}{
+		{isbn: "057504800X", want: "057504800X", ok: true},
+		{isbn: "0-575-04800-x", want: "057504800X", ok: true},
+		{isbn: "978 0765 326386", want: "9780765326386", ok: true},
+		{isbn: "abc1234567890", kind: ISBN_ILLEGAL_CHAR},
+		{isbn: "12345", kind: ISBN_BAD_LENGTH},
+		{isbn: "", kind: ISBN_BAD_LENGTH},
+		{isbn: "12X4567890", kind: ISBN_MISPLACED_X},
+		{isbn: "978057504800X", kind: ISBN_MISPLACED_X},
+		{isbn: "9780575048004", kind: ISBN_BAD_CHECKSUM},
+		{isbn: "0575048001", kind: ISBN_BAD_CHECKSUM},
+	}
+
+	for _, test := range tests {
+		got, err := parseISBN(test.isbn)
+		if test.ok {
+			if err != nil || got != test.want {
+				t.Errorf("parseISBN(%q) = %q, %v, want %q", test.isbn, got, err, test.want)
+			}
+			continue
+		}
+
+		var isbnErr *ISBNError
+		if !errors.As(err, &isbnErr) {
+			t.Errorf("parseISBN(%q) = %q, %v, want an *ISBNError", test.isbn, got, err)
+			continue
+		}
+		if isbnErr.Kind != test.kind {
+			t.Errorf("parseISBN(%q) error kind = %d, want %d", test.isbn, isbnErr.Kind, test.kind)
+		}
+	}
+}
+
+func FuzzParseISBN(f *testing.F) {
+	for _, seed := range []string{
+		"057504800X", "9780765326386", "978-0-7653-2638-6", "12X4567890",
+		"abc1234567890", "9780575048004", "xxxxxxxxxx", "",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, isbn string) {
+		parsed, err := parseISBN(isbn)
+		if err != nil {
+			var isbnErr *ISBNError
+			if !errors.As(err, &isbnErr) {
+				t.Fatalf("parseISBN(%q) returned a %T, want an *ISBNError", isbn, err)
+			}
+			return
+		}
+
+		if len(parsed) != 10 && len(parsed) != 13 {
+			t.Fatalf("parseISBN(%q) = %q, which is not 10 or 13 digits", isbn, parsed)
+		}
+		if again, err := parseISBN(parsed); err != nil || again != parsed {
+			t.Fatalf("parseISBN(%q) = %q, %v, want it to parse to itself", parsed, again, err)
+		}
+
+		isbn13, err := toISBN13(parsed)
+		if err != nil || !validISBN(isbn13) || len(isbn13) != 13 {
+			t.Fatalf("toISBN13(%q) = %q, %v, want a valid ISBN-13", parsed, isbn13, err)
+		}
+		if isbn10, err := toISBN10(isbn13); err == nil {
+			if back, _ := toISBN13(isbn10); back != isbn13 {
+				t.Fatalf("%q -> %q -> %q does not round trip", isbn13, isbn10, back)
+			}
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// the details a provider knows about a book
+type Metadata struct {
+	Provider string
+	ISBNs    []string
+	Title    string
+	Authors  []string
+	Genres   []string
+	Pages    int
+	CoverID  int
+}
+
+// a metadata provider, each provider knows how to build a request url for an
+// isbn or a free text query and how to parse the response
+type provider struct {
+	name     string
+	isbnURL  func(isbn string) string
+	queryURL func(query string) string
+	parse    func(body []byte) ([]Metadata, error)
+}
+
+const OPEN_LIBRARY_URL = "https://openlibrary.org/search.json"
+const OPEN_LIBRARY_FIELDS = "title,author_name,isbn,subject,number_of_pages_median,cover_i"
+
+var openLibrary = &provider{
+	name: "openlibrary",
+	isbnURL: func(isbn string) string {
+		return fmt.Sprintf("%s?isbn=%s&fields=%s", OPEN_LIBRARY_URL, url.QueryEscape(isbn), OPEN_LIBRARY_FIELDS)
+	},
+	queryURL: func(query string) string {
+		return fmt.Sprintf("%s?q=%s&fields=%s", OPEN_LIBRARY_URL, url.QueryEscape(query), OPEN_LIBRARY_FIELDS)
+	},
+	parse: func(body []byte) ([]Metadata, error) {
+		var json_ struct {
+			Docs []struct {
+				Title       string   `json:"title"`
+				AuthorNames []string `json:"author_name"`
+				ISBNs       []string `json:"isbn"`
+				Subjects    []string `json:"subject"`
+				Pages       int      `json:"number_of_pages_median"`
+				CoverID     int      `json:"cover_i"`
+			} `json:"docs"`
+		}
+		if err := json.Unmarshal(body, &json_); err != nil {
+			return nil, err
+		}
+
+		found := make([]Metadata, 0, len(json_.Docs))
+		for _, doc := range json_.Docs {
+			found = append(found, Metadata{
+				Provider: "openlibrary",
+				ISBNs:    doc.ISBNs,
+				Title:    doc.Title,
+				Authors:  doc.AuthorNames,
+				Genres:   doc.Subjects,
+				Pages:    doc.Pages,
+				CoverID:  doc.CoverID,
+			})
+		}
+		return found, nil
+	},
+}
+
+const GOOGLE_BOOKS_URL = "https://www.googleapis.com/books/v1/volumes"
+
+var googleBooks = &provider{
+	name: "google",
+	isbnURL: func(isbn string) string {
+		return fmt.Sprintf("%s?q=isbn:%s", GOOGLE_BOOKS_URL, url.QueryEscape(isbn))
+	},
+	queryURL: func(query string) string {
+		return fmt.Sprintf("%s?q=%s", GOOGLE_BOOKS_URL, url.QueryEscape(query))
+	},
+	parse: func(body []byte) ([]Metadata, error) {
+		var json_ struct {
+			Items []struct {
+				VolumeInfo struct {
+					Title               string   `json:"title"`
+					Authors             []string `json:"authors"`
+					Categories          []string `json:"categories"`
+					PageCount           int      `json:"pageCount"`
+					IndustryIdentifiers []struct {
+						Type       string `json:"type"`
+						Identifier string `json:"identifier"`
+					} `json:"industryIdentifiers"`
+				} `json:"volumeInfo"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(body, &json_); err != nil {
+			return nil, err
+		}
+
+		found := make([]Metadata, 0, len(json_.Items))
+		for _, item := range json_.Items {
+			info := item.VolumeInfo
+			isbns := []string{}
+			for _, id := range info.IndustryIdentifiers {
+				if id.Type == "ISBN_13" || id.Type == "ISBN_10" {
+					isbns = append(isbns, id.Identifier)
+				}
+			}
+			found = append(found, Metadata{
+				Provider: "google",
+				ISBNs:    isbns,
+				Title:    info.Title,
+				Authors:  info.Authors,
+				Genres:   info.Categories,
+				Pages:    info.PageCount,
+			})
+		}
+		return found, nil
+	},
+}
+
+var PROVIDERS = map[string]*provider{
+	openLibrary.name: openLibrary,
+	googleBooks.name: googleBooks,
+}
+
+// the order providers are tried in
+var PROVIDER_ORDER = []string{openLibrary.name, googleBooks.name}
+
+func httpGet(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("'%s' returned '%s'", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// looks up an isbn, going through the cache first
+func lookupISBN(db *sql.DB, offline bool, p *provider, isbn string) ([]Metadata, error) {
+	body, err := fetchCached(db, offline, p.name, "isbn:"+isbn, p.isbnURL(isbn))
+	if err != nil {
+		return nil, err
+	}
+	return p.parse(body)
+}
+
+// looks up a free text query, going through the cache first
+func lookupQuery(db *sql.DB, offline bool, p *provider, query string) ([]Metadata, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	body, err := fetchCached(db, offline, p.name, "q:"+query, p.queryURL(query))
+	if err != nil {
+		return nil, err
+	}
+	return p.parse(body)
+}
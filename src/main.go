@@ -1,99 +1,54 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 	"os"
-	"path"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/urfave/cli/v3"
 )
 
-type config struct {
-	dbPath string
-}
-
-func ReadConfigFile(path string) (config, error) {
-	f, err := os.ReadFile(path)
-	if err != nil {
-		return config{}, err
-	}
-
-	dbPath := ""
-	for line := range bytes.Lines(f) {
-		parts := bytes.Split(bytes.TrimSpace(line), []byte{'='})
-		key := bytes.TrimSpace(parts[0])
-		value := bytes.TrimSpace(parts[1])
-		if string(key) == "db_path" {
-			dbPath = string(value)
-			break
+// returns $XDG_DATA_HOME/bookTracker, falling back to ~/.local/share/bookTracker,
+// or %LOCALAPPDATA%\bookTracker on windows
+func dataDir() (string, error) {
+	if runtime.GOOS == "windows" {
+		localAppData, isSet := os.LookupEnv("LOCALAPPDATA")
+		if !isSet {
+			return "", errors.New("`LOCALAPPDATA` is not set")
 		}
+		return filepath.Join(localAppData, "bookTracker"), nil
 	}
 
-	if dbPath == "" {
-		return config{}, errors.New("[malformed config file]: file must contain `db_path = /path/to/database`")
+	if xdg_data_home, isSet := os.LookupEnv("XDG_DATA_HOME"); isSet && xdg_data_home != "" {
+		return filepath.Join(xdg_data_home, "bookTracker"), nil
 	}
-
-	return config{dbPath}, nil
-}
-
-func GetConfig() (config, error) {
-	xdg_config_home, err := os.UserConfigDir()
+	home, err := os.UserHomeDir()
 	if err != nil {
-		return config{}, err
+		return "", err
 	}
+	return filepath.Join(home, ".local", "share", "bookTracker"), nil
+}
 
-	path_ := path.Join(xdg_config_home, "bookTracker", "bookTracker.conf")
-	if _, err := os.Stat(path_); errors.Is(err, os.ErrNotExist) {
-		fmt.Printf("`%s` does not exist creating it\n", path_)
-
-		err = os.Mkdir(path.Join(xdg_config_home, "bookTracker"), os.ModePerm)
-		if err != nil {
-			return config{}, err
-		}
-
-		// create bookTracker.conf
-		data := fmt.Appendf(nil, "db_path = %s", path.Join(xdg_config_home, "bookTracker", "books.db"))
-		err = os.WriteFile(path_, data, 0666)
-		if err != nil {
-			return config{}, err
-		}
-
-		xdg_data_home_path := "XDG_DATA_HOME"
-		if runtime.GOOS == "windows" {
-			xdg_data_home_path = "LOCALAPPDATA"
-		}
-
-		xdg_data_home, isSet := os.LookupEnv(xdg_data_home_path)
-		if !isSet {
-			return config{}, fmt.Errorf("`%s` is not set", xdg_data_home_path)
-		}
-
-		// make $XDG_DATA_HOME/bookTracker
-		err = os.Mkdir(path.Join(xdg_data_home, "bookTracker"), os.ModePerm)
-		if err != nil {
-			return config{}, err
+func initDB(dbPath string) (*sql.DB, error) {
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "INFO: '%s' does not exist, creating it\n", dbPath)
+		if err := os.MkdirAll(filepath.Dir(dbPath), os.ModePerm); err != nil {
+			return nil, err
 		}
 	}
 
-	return ReadConfigFile(path_)
-}
-
-func initDB(dbPath string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
-		fmt.Println("INFO: 'books.db' does not exist, creating 'books.db'")
-	}
-
 	const CREATESCHEMAQUERY = `CREATE TABLE IF NOT EXISTS books (
 		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
 		isbn TEXT,
@@ -106,33 +61,140 @@ func initDB(dbPath string) (*sql.DB, error) {
 		genres TEXT
 	);`
 
-	_, err = db.Exec(CREATESCHEMAQUERY)
-	if err != nil {
+	for _, query := range []string{CREATESCHEMAQUERY, CREATECACHEQUERY} {
+		if _, err := db.Exec(query); err != nil {
+			return nil, err
+		}
+	}
+	// without fts5 the search triggers have to go before a migration writes to
+	// books, with it the index is made on top of the migrated schema
+	search := searchAvailable(db)
+	if !search {
+		if err := ensureSearchIndex(db); err != nil {
+			return nil, err
+		}
+	}
+	if err := migrate(db); err != nil {
 		return nil, err
 	}
+	if search {
+		if err := ensureSearchIndex(db); err != nil {
+			return nil, err
+		}
+	}
 	return db, nil
 }
 
 type myCtx struct{}
 
-func main() {
-	// config, err := GetConfig()
-	// if err != nil {
-	// 	fmt.Fprintln(os.Stderr, err)
-	// 	os.Exit(1)
-	// }
-	config := config{"books.db"}
-
-	db, err := initDB(config.dbPath)
+// resolves the database path, in order of precedence: --db, $BOOKTRACKER_DB,
+// then the path from the config
+func resolveDBPath(c *cli.Command, cfg config) (string, error) {
+	if c.IsSet("db") {
+		return expandHome(c.String("db"))
+	}
+	return configDBPath(cfg)
+}
+
+// db_path from the config or profile, otherwise books.db, or NAME.db for a
+// profile, in the data directory
+func configDBPath(cfg config) (string, error) {
+	if cfg.dbPath != "" {
+		return expandHome(cfg.dbPath)
+	}
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	if cfg.profile != "" {
+		return filepath.Join(dir, cfg.profile+".db"), nil
+	}
+	return filepath.Join(dir, "books.db"), nil
+}
+
+// expands a leading ~ to the home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// loads the config and opens the database, storing both in the context
+// commands with this set in their Metadata, or under one that has it, run
+// without the config or database being loaded. they are the ones needed to
+// fix a broken config, or that have no use for either
+const SKIP_SETUP = "skip_setup"
+
+// whether the command the arguments lead to skips setup. the root Before runs
+// before the subcommand is picked so the arguments are followed by hand
+func skipsSetup(c *cli.Command) bool {
+	cmd := c
+	for _, arg := range c.Args().Slice() {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if cmd = cmd.Command(arg); cmd == nil {
+			return false
+		}
+		if skip, _ := cmd.Metadata[SKIP_SETUP].(bool); skip {
+			return true
+		}
+	}
+	return false
+}
+
+// the config with the profile from --profile, or the config, applied
+func loadConfig(c *cli.Command) (config, error) {
+	cfg, err := GetConfig()
 	if err != nil {
-		log.Fatal(err)
+		return config{}, err
+	}
+	profile := cfg.defaultProfile
+	if c.IsSet("profile") {
+		profile = c.String("profile")
 	}
-	defer db.Close()
+	return cfg.withProfile(profile)
+}
 
-	mainCtx := myCtx{}
-	ctx := context.WithValue(context.Background(), mainCtx, db)
+func setup(ctx context.Context, c *cli.Command) (context.Context, error) {
+	if skipsSetup(c) {
+		return ctx, nil
+	}
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return ctx, err
+	}
+	if cfg.defaults.timezone != nil {
+		time.Local = cfg.defaults.timezone
+	}
 
-	if err := CMD.Run(ctx, os.Args); err != nil {
+	dbPath, err := resolveDBPath(c, cfg)
+	if err != nil {
+		return ctx, err
+	}
+	db, err := initDB(dbPath)
+	if err != nil {
+		return ctx, err
+	}
+
+	ctx = context.WithValue(ctx, myCtx{}, db)
+	return context.WithValue(ctx, configCtx{}, cfg), nil
+}
+
+func teardown(ctx context.Context, c *cli.Command) error {
+	if db, ok := ctx.Value(myCtx{}).(*sql.DB); ok {
+		return db.Close()
+	}
+	return nil
+}
+
+func main() {
+	if err := CMD.Run(context.Background(), os.Args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// migrations are run in order on top of CREATESCHEMAQUERY, the number of
+// migrations that have been run is stored in the databases user_version.
+// never reorder or remove a migration, only append new ones
+var MIGRATIONS = []func(tx *sql.Tx) error{
+	// 1: covers
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec("ALTER TABLE books ADD COLUMN cover_path TEXT")
+		return err
+	},
+	// 2: canonical isbn 13s, keeping the isbn as it was entered
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec("ALTER TABLE books ADD COLUMN isbn_original TEXT"); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query("SELECT id, isbn FROM books WHERE isbn IS NOT NULL AND isbn != ''")
+		if err != nil {
+			return err
+		}
+		isbns := map[int64]string{}
+		for rows.Next() {
+			var id int64
+			var isbn string
+			if err := rows.Scan(&id, &isbn); err != nil {
+				rows.Close()
+				return err
+			}
+			isbns[id] = isbn
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for id, isbn := range isbns {
+			const QUERY = "UPDATE books SET isbn = ?, isbn_original = ? WHERE id = ?"
+			if _, err := tx.Exec(QUERY, migrationCanonicalISBN(isbn), isbn, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 3: store dates as RFC 3339 text with their offset instead of unix seconds
+	func(tx *sql.Tx) error {
+		const CREATEQUERY = `CREATE TABLE books_new (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			isbn TEXT,
+			isbn_original TEXT,
+			author TEXT NOT NULL,
+			title TEXT NOT NULL,
+			series TEXT,
+			date_started TEXT,
+			date_finished TEXT,
+			status INTEGER NOT NULL DEFAULT 0,
+			genres TEXT,
+			cover_path TEXT
+		);`
+		if _, err := tx.Exec(CREATEQUERY); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query("SELECT id, isbn, isbn_original, author, title, series, date_started, date_finished, status, genres, cover_path FROM books")
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id                         int64
+			isbn, isbnOriginal, series sql.NullString
+			author, title              string
+			started, finished          sql.NullInt64
+			status                     int
+			genres, coverPath          sql.NullString
+		}
+		books := []row{}
+		for rows.Next() {
+			var r row
+			err := rows.Scan(&r.id, &r.isbn, &r.isbnOriginal, &r.author, &r.title, &r.series,
+				&r.started, &r.finished, &r.status, &r.genres, &r.coverPath)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			books = append(books, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// the old unix times are converted to local time, the best guess at
+		// where they were entered
+		toStored := func(unix sql.NullInt64) any {
+			if !unix.Valid {
+				return nil
+			}
+			return time.Unix(unix.Int64, 0).Local().Format(time.RFC3339)
+		}
+		for _, r := range books {
+			const QUERY = `INSERT INTO books_new (id, isbn, isbn_original, author, title, series,
+				date_started, date_finished, status, genres, cover_path) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+			_, err := tx.Exec(QUERY, r.id, r.isbn, r.isbnOriginal, r.author, r.title, r.series,
+				toStored(r.started), toStored(r.finished), r.status, r.genres, r.coverPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DROP TABLE books"); err != nil {
+			return err
+		}
+		_, err = tx.Exec("ALTER TABLE books_new RENAME TO books")
+		return err
+	},
+	// 4: full text search. whether the index can exist depends on the build,
+	// not the schema, so ensureSearchIndex makes it once migrations are done
+	func(tx *sql.Tx) error {
+		return nil
+	},
+	// 5: shelves, saved --where filters
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE shelves (
+			name TEXT NOT NULL PRIMARY KEY,
+			filter TEXT NOT NULL
+		);`)
+		return err
+	},
+	// 6: collections
+	func(tx *sql.Tx) error {
+		for _, query := range CREATECOLLECTIONQUERIES {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 7: series and the position of a book in its series
+	func(tx *sql.Tx) error {
+		queries := append([]string{"ALTER TABLE books ADD COLUMN series_position REAL"}, CREATESERIESQUERIES...)
+		queries = append(queries, "INSERT OR IGNORE INTO series (name) SELECT DISTINCT series FROM books WHERE COALESCE(series, '') != ''")
+		for _, query := range queries {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 8: authors, splitting co-authored books into their authors
+	func(tx *sql.Tx) error {
+		for _, query := range CREATEAUTHORQUERIES {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+
+		rows, err := tx.Query("SELECT id, author FROM books WHERE author != ''")
+		if err != nil {
+			return err
+		}
+		authors := map[int64]string{}
+		for rows.Next() {
+			var id int64
+			var author string
+			if err := rows.Scan(&id, &author); err != nil {
+				rows.Close()
+				return err
+			}
+			authors[id] = author
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// names were lowercased when this ran, so name is its own key
+		separator := regexp.MustCompile(`(?i)\s*(?:&|;|\band\b)\s*`)
+		for id, author := range authors {
+			for ix, name := range separator.Split(author, -1) {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+				if _, err := tx.Exec("INSERT OR IGNORE INTO authors (name) VALUES(?)", name); err != nil {
+					return err
+				}
+				const QUERY = `INSERT OR IGNORE INTO book_authors (book_id, author_id, role, position)
+					SELECT ?, id, 'author', ? FROM authors WHERE name = ?`
+				if _, err := tx.Exec(QUERY, id, ix, name); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = tx.Exec(`UPDATE books SET author = COALESCE((
+				SELECT group_concat(name, ' & ') FROM (
+					SELECT a.name FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+					WHERE ba.book_id = books.id ORDER BY ba.position
+				)
+			), author)`)
+		return err
+	},
+	// 9: keep the casing titles, authors and series were entered with, matching
+	// is done on the normalised *_key columns instead. everything was stored
+	// lowercased before so title case it, like it used to be shown
+	func(tx *sql.Tx) error {
+		queries := []string{
+			"ALTER TABLE books ADD COLUMN title_key TEXT NOT NULL DEFAULT ''",
+			"ALTER TABLE books ADD COLUMN author_key TEXT NOT NULL DEFAULT ''",
+			"ALTER TABLE books ADD COLUMN series_key TEXT NOT NULL DEFAULT ''",
+			"ALTER TABLE authors ADD COLUMN name_key TEXT NOT NULL DEFAULT ''",
+		}
+		queries = append(queries, SERIESKEYQUERIES...)
+		for _, query := range queries {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+
+		caser := cases.Title(language.Und)
+		recase := func(table, column, key string) error {
+			rows, err := tx.Query(fmt.Sprintf("SELECT id, %s FROM %s WHERE %s IS NOT NULL", column, table, column))
+			if err != nil {
+				return err
+			}
+			values := map[int64]string{}
+			for rows.Next() {
+				var id int64
+				var value string
+				if err := rows.Scan(&id, &value); err != nil {
+					rows.Close()
+					return err
+				}
+				values[id] = value
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			query := fmt.Sprintf("UPDATE %s SET %s = ?, %s = ? WHERE id = ?", table, column, key)
+			for id, value := range values {
+				if _, err := tx.Exec(query, caser.String(value), migrationNormaliseName(value), id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		// series first so the series triggers find the keys of existing series
+		for _, col := range [][3]string{
+			{"series", "name", "name_key"},
+			{"authors", "name", "name_key"},
+			{"books", "title", "title_key"},
+			{"books", "series", "series_key"},
+		} {
+			if err := recase(col[0], col[1], col[2]); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`UPDATE books SET (author, author_key) = (
+				SELECT COALESCE(group_concat(name, ' & '), ''), COALESCE(group_concat(name_key, ' '), '') FROM (
+					SELECT a.name, a.name_key FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+					WHERE ba.book_id = books.id AND ba.role = 'author' ORDER BY ba.position
+				)
+			)`)
+		return err
+	},
+	// 10: yearly reading goals
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE goals (
+			year INTEGER NOT NULL PRIMARY KEY,
+			books INTEGER NOT NULL
+		);`)
+		return err
+	},
+	// 11: the reading log, a row for every day a book was read
+	func(tx *sql.Tx) error {
+		queries := []string{
+			`CREATE TABLE reading_log (
+				book_id INTEGER NOT NULL,
+				day TEXT NOT NULL,
+				PRIMARY KEY (book_id, day)
+			);`,
+			`CREATE TRIGGER reading_log_delete AFTER DELETE ON books BEGIN
+				DELETE FROM reading_log WHERE book_id = old.id;
+			END;`,
+		}
+		for _, query := range queries {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 12: a rating out of 5 and a written review
+	func(tx *sql.Tx) error {
+		for _, query := range []string{"ALTER TABLE books ADD COLUMN rating INTEGER", "ALTER TABLE books ADD COLUMN review TEXT"} {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 13: one book per isbn. an isbn 10 and the isbn 13 of the same book are
+	// the same after migration 2, the oldest book keeps the isbn and the others
+	// lose it, what was entered stays in isbn_original
+	func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT id, title, isbn FROM books WHERE isbn IN (
+			SELECT isbn FROM books WHERE isbn IS NOT NULL AND isbn != '' GROUP BY isbn HAVING count(*) > 1
+		) ORDER BY isbn, id`)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id          int64
+			title, isbn string
+		}
+		duplicates := []row{}
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.title, &r.isbn); err != nil {
+				rows.Close()
+				return err
+			}
+			duplicates = append(duplicates, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		var kept row
+		for _, r := range duplicates {
+			if r.isbn != kept.isbn {
+				kept = r
+				continue
+			}
+			if _, err := tx.Exec("UPDATE books SET isbn = NULL WHERE id = ?", r.id); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "WARN: '%s' (id %d) had the same isbn '%s' as '%s' (id %d), it has been removed from '%s'\n",
+				r.title, r.id, r.isbn, kept.title, kept.id, r.title)
+		}
+
+		_, err = tx.Exec("CREATE UNIQUE INDEX books_isbn ON books (isbn) WHERE isbn IS NOT NULL AND isbn != ''")
+		return err
+	},
+	// 14: reviews are searchable. books_fts needs fts5 to be dropped, so only
+	// its triggers go here and ensureSearchIndex makes it again with the review
+	func(tx *sql.Tx) error {
+		for _, query := range []string{
+			"DROP TRIGGER IF EXISTS books_fts_insert",
+			"DROP TRIGGER IF EXISTS books_fts_delete",
+			"DROP TRIGGER IF EXISTS books_fts_update",
+		} {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 15: reading progress, the page or percent reached on a day, and quotes
+	func(tx *sql.Tx) error {
+		queries := []string{
+			`CREATE TABLE progress (
+				book_id INTEGER NOT NULL,
+				day TEXT NOT NULL,
+				page INTEGER,
+				percent INTEGER,
+				PRIMARY KEY (book_id, day)
+			);`,
+			`CREATE TRIGGER progress_delete AFTER DELETE ON books BEGIN
+				DELETE FROM progress WHERE book_id = old.id;
+			END;`,
+			`CREATE TABLE quotes (
+				id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+				book_id INTEGER NOT NULL,
+				text TEXT NOT NULL,
+				page INTEGER,
+				favourite INTEGER NOT NULL DEFAULT 0,
+				added TEXT NOT NULL
+			);`,
+			`CREATE TRIGGER quotes_delete AFTER DELETE ON books BEGIN
+				DELETE FROM quotes WHERE book_id = old.id;
+			END;`,
+		}
+		for _, query := range queries {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 16: quotes are searchable, like 14 ensureSearchIndex makes books_fts
+	// again once its triggers are gone
+	func(tx *sql.Tx) error {
+		for _, query := range []string{
+			"DROP TRIGGER IF EXISTS books_fts_insert",
+			"DROP TRIGGER IF EXISTS books_fts_delete",
+			"DROP TRIGGER IF EXISTS books_fts_update",
+		} {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 17: 13 left isbn_original on the books it took a duplicate isbn from, so
+	// they still matched the isbn they lost. it goes too
+	func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT id, isbn_original FROM books
+			WHERE (isbn IS NULL OR isbn = '') AND isbn_original IS NOT NULL AND isbn_original != ''`)
+		if err != nil {
+			return err
+		}
+		originals := map[int64]string{}
+		for rows.Next() {
+			var id int64
+			var original string
+			if err := rows.Scan(&id, &original); err != nil {
+				rows.Close()
+				return err
+			}
+			originals[id] = original
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for id, original := range originals {
+			var taken bool
+			const QUERY = "SELECT EXISTS (SELECT 1 FROM books WHERE isbn = ? AND id != ?)"
+			if err := tx.QueryRow(QUERY, migrationCanonicalISBN(original), id).Scan(&taken); err != nil {
+				return err
+			}
+			if !taken {
+				continue
+			}
+			if _, err := tx.Exec("UPDATE books SET isbn_original = NULL WHERE id = ?", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 18: how many pages a book has
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec("ALTER TABLE books ADD COLUMN pages INTEGER")
+		return err
+	},
+	// 19: a goal can have a pages target
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec("ALTER TABLE goals ADD COLUMN pages INTEGER")
+		return err
+	},
+	// 20: series without books are removed
+	func(tx *sql.Tx) error {
+		for _, query := range SERIESCLEANUPQUERIES {
+			if _, err := tx.Exec(query); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// copies of canonicalISBN and normaliseName as they were when the migrations
+// using them were written. a migration has to do the same thing to every
+// database it runs on, so changes to the live versions must not reach these
+
+// a valid isbn 10 or 13 as an isbn 13, anything else without its separators
+func migrationCanonicalISBN(isbn string) string {
+	clean := strings.ReplaceAll(strings.ReplaceAll(isbn, "-", ""), " ", "")
+	digits := strings.ToUpper(clean)
+	values := []int{}
+	for ix, r := range digits {
+		switch {
+		case r >= '0' && r <= '9':
+			values = append(values, int(r-'0'))
+		case r == 'X' && ix == 9 && len(digits) == 10:
+			values = append(values, 10)
+		default:
+			return clean
+		}
+	}
+
+	isbn13Check := func(first12 []int) int {
+		sum := 0
+		for ix, v := range first12 {
+			sum += v * (1 + 2*(ix%2))
+		}
+		return (10 - sum%10) % 10
+	}
+	switch len(values) {
+	case 13:
+		if isbn13Check(values[:12]) != values[12] {
+			return clean
+		}
+		return digits
+	case 10:
+		sum := 0
+		for ix, v := range values[:9] {
+			sum += (10 - ix) * v
+		}
+		if (11-sum%11)%11 != values[9] {
+			return clean
+		}
+		return "978" + digits[:9] + strconv.Itoa(isbn13Check(append([]int{9, 7, 8}, values[:9]...)))
+	}
+	return clean
+}
+
+// lowercased without diacritics or punctuation
+func migrationNormaliseName(s string) string {
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+	if err != nil {
+		stripped = s
+	}
+	stripped = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		if r == '\'' || r == '’' {
+			return -1
+		}
+		return ' '
+	}, stripped)
+	return strings.Join(strings.Fields(stripped), " ")
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for ix := version; ix < len(MIGRATIONS); ix++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := MIGRATIONS[ix](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", ix+1, err)
+		}
+		// PRAGMA does not support placeholders
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", ix+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// a book along with the profile it came from, used by `list --all-profiles`
+type profileBook struct {
+	Profile string `json:"profile"`
+	Book
+}
+
+// the names of every profile, starting with DEFAULT_PROFILE
+func profileNames(cfg config) []string {
+	names := []string{DEFAULT_PROFILE}
+	for _, p := range cfg.profiles {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+// runs filter against the database of every profile. the profile in use is
+// read from db, the database setup opened, so --db and $BOOKTRACKER_DB are
+// honoured. the other profiles whose database does not exist yet are skipped
+func queryAllProfiles(c *cli.Command, db *sql.DB, cfg config, filter bookFilter) ([]profileBook, error) {
+	current := cfg.profile
+	if current == "" {
+		current = DEFAULT_PROFILE
+	}
+	currentPath, err := resolveDBPath(c, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	books := []profileBook{}
+	for _, name := range profileNames(cfg) {
+		profileDB := db
+		if name != current {
+			profileCfg, err := cfg.withProfile(name)
+			if err != nil {
+				return nil, err
+			}
+			dbPath, err := configDBPath(profileCfg)
+			if err != nil {
+				return nil, err
+			}
+			// --db can point at the database of another profile
+			if dbPath == currentPath {
+				continue
+			}
+			if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if profileDB, err = initDB(dbPath); err != nil {
+				return nil, err
+			}
+			defer profileDB.Close()
+		}
+
+		found, err := queryBooks(profileDB, filter)
+		if err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", name, err)
+		}
+		for _, book := range found {
+			books = append(books, profileBook{name, book})
+		}
+	}
+	return books, nil
+}
+
+func isSectionHeader(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "[")
+}
+
+// returns the lines of the config file with section removed
+func removeConfigSection(lines []string, section string) []string {
+	header := "[" + section + "]"
+	start := -1
+	for ix, line := range lines {
+		if strings.TrimSpace(line) == header {
+			start = ix
+			break
+		}
+	}
+	if start == -1 {
+		return lines
+	}
+
+	end := start + 1
+	for end < len(lines) && !isSectionHeader(lines[end]) {
+		end++
+	}
+	return append(lines[:start:start], lines[end:]...)
+}
+
+// sets or removes, if value is empty, a key outside of any section
+func setTopLevelKey(lines []string, key, value string) []string {
+	line := fmt.Sprintf("%s = %s", key, strconv.Quote(value))
+	for ix, l := range lines {
+		if isSectionHeader(l) {
+			break
+		}
+		k, _, found := strings.Cut(l, "=")
+		if !found || strings.TrimSpace(k) != key {
+			continue
+		}
+		if value == "" {
+			return append(lines[:ix:ix], lines[ix+1:]...)
+		}
+		lines[ix] = line
+		return lines
+	}
+	if value == "" {
+		return lines
+	}
+	return append([]string{line}, lines...)
+}
+
+// applies edit to the lines of the config file, checking the result is still
+// a valid config before writing it
+func editConfigFile(edit func(lines []string) []string) error {
+	path_, err := configPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path_)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	edited := strings.TrimRight(strings.Join(edit(lines), "\n"), "\n") + "\n"
+	if _, err := parseConfig(path_, []byte(edited)); err != nil {
+		return fmt.Errorf("refusing to write an invalid config: %w", err)
+	}
+	return os.WriteFile(path_, []byte(edited), 0666)
+}
+
+var profileCmd = &cli.Command{
+	Name:  "profile",
+	Usage: "manage separate named libraries",
+	Commands: []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "list every profile and its database",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				active := ctx.Value(configCtx{}).(config).profile
+				if active == "" {
+					active = DEFAULT_PROFILE
+				}
+				base, err := GetConfig()
+				if err != nil {
+					return err
+				}
+
+				names := profileNames(base)
+				width := 0
+				for _, name := range names {
+					width = max(width, len(name))
+				}
+				for _, name := range names {
+					cfg, err := base.withProfile(name)
+					if err != nil {
+						return err
+					}
+					dbPath, err := configDBPath(cfg)
+					if err != nil {
+						return err
+					}
+
+					marker := " "
+					if name == active {
+						marker = "*"
+					}
+					fmt.Printf("%s %-*s  %s\n", marker, width, name, dbPath)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "add",
+			Usage:     "add a new profile",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "db-path",
+					Usage:       "the `path` to the profiles database",
+					DefaultText: "NAME.db in the data directory",
+					TakesFile:   true,
+				},
+			},
+			Action: func(_ context.Context, c *cli.Command) error {
+				name := c.StringArg("name")
+				if err := validProfileName(name); err != nil {
+					return err
+				}
+				base, err := GetConfig()
+				if err != nil {
+					return err
+				}
+				if base.findProfile(name) != nil {
+					return fmt.Errorf("profile '%s' already exists", name)
+				}
+
+				return editConfigFile(func(lines []string) []string {
+					lines = append(lines, "", "[profile."+name+"]")
+					if c.IsSet("db-path") {
+						lines = append(lines, "db_path = "+strconv.Quote(c.String("db-path")))
+					}
+					return lines
+				})
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "remove a profile, its database is left alone",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Action: func(_ context.Context, c *cli.Command) error {
+				name := c.StringArg("name")
+				base, err := GetConfig()
+				if err != nil {
+					return err
+				}
+				if base.findProfile(name) == nil {
+					return fmt.Errorf("profile '%s' does not exist", name)
+				}
+
+				err = editConfigFile(func(lines []string) []string {
+					if base.defaultProfile == name {
+						lines = setTopLevelKey(lines, "profile", "")
+					}
+					return removeConfigSection(lines, "profile."+name)
+				})
+				if err != nil {
+					return err
+				}
+
+				cfg, err := base.withProfile(name)
+				if err != nil {
+					return err
+				}
+				if dbPath, err := configDBPath(cfg); err == nil {
+					fmt.Printf("removed profile '%s', its database '%s' was not deleted\n", name, dbPath)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "default",
+			Usage:     "set the profile used when --profile is not given",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Action: func(_ context.Context, c *cli.Command) error {
+				name := c.StringArg("name")
+				if name == "" {
+					return errors.New("a profile name must be provided")
+				}
+				base, err := GetConfig()
+				if err != nil {
+					return err
+				}
+				if name != DEFAULT_PROFILE && base.findProfile(name) == nil {
+					return fmt.Errorf("profile '%s' does not exist", name)
+				}
+
+				return editConfigFile(func(lines []string) []string {
+					if name == DEFAULT_PROFILE {
+						return setTopLevelKey(lines, "profile", "")
+					}
+					return setTopLevelKey(lines, "profile", name)
+				})
+			},
+		},
+	},
+}
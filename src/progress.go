@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// how far into a book you were on a day, a page or a percent
+type progressEntry struct {
+	Day     string `json:"day"`
+	Page    int    `json:"page,omitempty"`
+	Percent int    `json:"percent,omitempty"`
+}
+
+func (p progressEntry) String() string {
+	if p.Page > 0 {
+		return fmt.Sprintf("%s page %d", p.Day, p.Page)
+	}
+	return fmt.Sprintf("%s %d%%", p.Day, p.Percent)
+}
+
+// the progress recorded for a book, oldest first
+func bookProgress(db *sql.DB, id int64) ([]progressEntry, error) {
+	const QUERY = "SELECT day, COALESCE(page, 0), COALESCE(percent, 0) FROM progress WHERE book_id = ? ORDER BY day"
+	rows, err := db.Query(QUERY, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []progressEntry{}
+	for rows.Next() {
+		var entry progressEntry
+		if err := rows.Scan(&entry.Day, &entry.Page, &entry.Percent); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+var progressCmd = &cli.Command{
+	Name:  "progress",
+	Usage: "record how far into a book you are, or show how far you have got",
+	Description: "without --page or --percent the progress so far is shown. without a book the one you are reading\n" +
+		"is used, as long as you are only reading one. a day has one entry, recording it again replaces it,\n" +
+		"and the day is logged as a reading day, see `log`",
+	Arguments: commonArgs,
+	ArgsUsage: "[[title author]|ISBN|id]",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "page",
+			Usage: "the `page` you got to",
+			Action: func(ctx context.Context, c *cli.Command, n int) error {
+				if n < 1 {
+					return fmt.Errorf("'%d' is not a valid page, it must be at least 1", n)
+				}
+				return nil
+			},
+		},
+		&cli.IntFlag{
+			Name:  "percent",
+			Usage: "how far through the book you got, as a `percent`",
+			Action: func(ctx context.Context, c *cli.Command, n int) error {
+				if n < 0 || n > 100 {
+					return fmt.Errorf("'%d' is not a valid percent, it must be from 0 to 100", n)
+				}
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name:        "date",
+			Aliases:     []string{"d"},
+			Usage:       "the `date` of the progress, 2006-01-02 or 'yesterday', 'last friday', '3 days ago', 'oct 3'",
+			DefaultText: "today",
+			Action:      validDateAction,
+		},
+		&cli.BoolFlag{
+			Name:  "remove",
+			Usage: "remove the progress on the date instead",
+		},
+		formatFlag,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		db := ctx.Value(myCtx{}).(*sql.DB)
+		cfg := ctx.Value(configCtx{}).(config)
+		var book Book
+		var err error
+		if c.StringArg("title") == "" && !c.Bool("ISBN") {
+			book, err = readingBook(db)
+		} else {
+			book, err = resolveBookArgs(db, c)
+		}
+		if err != nil {
+			return err
+		}
+
+		if c.IsSet("page") && c.IsSet("percent") {
+			return errors.New("only one of --page and --percent can be given")
+		}
+		if !c.IsSet("page") && !c.IsSet("percent") && !c.Bool("remove") {
+			entries, err := bookProgress(db, book.ID)
+			if err != nil {
+				return err
+			}
+			if outputFormat(c, cfg) == "json" {
+				return printJSON(entries)
+			}
+			if len(entries) == 0 {
+				fmt.Fprintf(os.Stderr, "INFO: no progress has been recorded for '%s'\n", book.Title)
+			}
+			for _, entry := range entries {
+				fmt.Println(entry)
+			}
+			return nil
+		}
+
+		date, err := flagDateEcho(c, "date")
+		if err != nil {
+			return err
+		}
+		if date.After(time.Now()) {
+			return fmt.Errorf("can not record progress on %s, it has not happened yet", date.Format(time.DateOnly))
+		}
+		day := midnight(date).Format(time.DateOnly)
+
+		if c.Bool("remove") {
+			res, err := db.Exec("DELETE FROM progress WHERE book_id = ? AND day = ?", book.ID, day)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return fmt.Errorf("'%s' has no progress on %s", book.Title, day)
+			}
+			fmt.Fprintf(os.Stderr, "INFO: removed the progress of '%s' on %s\n", book.Title, day)
+			return nil
+		}
+
+		entry := progressEntry{Day: day, Page: c.Int("page"), Percent: c.Int("percent")}
+		var page, percent any
+		if c.IsSet("page") {
+			page = entry.Page
+		} else {
+			percent = entry.Percent
+		}
+		err = execAll(db,
+			execStmt("INSERT OR REPLACE INTO progress (book_id, day, page, percent) VALUES(?, ?, ?, ?)", book.ID, day, page, percent),
+			execStmt("INSERT OR IGNORE INTO reading_log (book_id, day) VALUES(?, ?)", book.ID, day),
+		)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "INFO: recorded the progress of '%s', %s\n", book.Title, entry)
+		return nil
+	},
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// a passage copied out of a book
+type quote struct {
+	ID        int64     `json:"id"`
+	BookID    int64     `json:"book_id"`
+	Text      string    `json:"text"`
+	Page      int       `json:"page,omitempty"`
+	Favourite bool      `json:"favourite"`
+	Added     time.Time `json:"added"`
+}
+
+func (q quote) String() string {
+	s := fmt.Sprintf("%d: \"%s\"", q.ID, q.Text)
+	if q.Page > 0 {
+		s += fmt.Sprintf(" (page %d)", q.Page)
+	}
+	if q.Favourite {
+		s += " ★"
+	}
+	return s
+}
+
+// the quotes matching filter, in the order they were added
+func queryQuotes(db *sql.DB, filter bookFilter) ([]quote, error) {
+	query := "SELECT id, book_id, text, COALESCE(page, 0), favourite, added FROM quotes"
+	if len(filter.where) > 0 {
+		query += " WHERE " + strings.Join(filter.where, " AND ")
+	}
+	rows, err := db.Query(query+" ORDER BY id", filter.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotes := []quote{}
+	for rows.Next() {
+		var q quote
+		var added sql.NullString
+		if err := rows.Scan(&q.ID, &q.BookID, &q.Text, &q.Page, &q.Favourite, &added); err != nil {
+			return nil, err
+		}
+		if q.Added, err = parseStoredTime(added); err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, q)
+	}
+	return quotes, rows.Err()
+}
+
+func bookQuotes(db *sql.DB, id int64) ([]quote, error) {
+	filter := bookFilter{}
+	filter.add("book_id = ?", id)
+	return queryQuotes(db, filter)
+}
+
+func quoteIDArg(db *sql.DB, c *cli.Command) (int64, error) {
+	id, err := strconv.ParseInt(c.StringArg("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("'%s' is not a valid quote id", c.StringArg("id"))
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM quotes WHERE id = ?)", id).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("quote with id: '%d' does not exist", id)
+	}
+	return id, nil
+}
+
+var quoteIDArgs = []cli.Argument{&cli.StringArg{Name: "id"}}
+
+var quoteCmd = &cli.Command{
+	Name:  "quote",
+	Usage: "keep passages from the books you read",
+	Commands: []*cli.Command{
+		{
+			Name:        "add",
+			Usage:       "add a quote to a book",
+			Description: "without a book the one you are reading is used, as long as you are only reading one",
+			Arguments: []cli.Argument{
+				&cli.StringArg{Name: "quote"},
+				&cli.StringArg{Name: "title"},
+				&cli.StringArg{Name: "author"},
+			},
+			ArgsUsage: "QUOTE [[title author]|ISBN|id]",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  "page",
+					Usage: "the `page` the quote is on",
+					Action: func(ctx context.Context, c *cli.Command, n int) error {
+						if n < 1 {
+							return fmt.Errorf("'%d' is not a valid page, it must be at least 1", n)
+						}
+						return nil
+					},
+				},
+				&cli.BoolFlag{
+					Name:  "favourite",
+					Usage: "mark the quote as a favourite, favourites go in the year in review",
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				text := strings.TrimSpace(c.StringArg("quote"))
+				if text == "" {
+					return errors.New("a quote must be provided")
+				}
+
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				var book Book
+				var err error
+				if c.StringArg("title") == "" && !c.Bool("ISBN") {
+					book, err = readingBook(db)
+				} else {
+					book, err = resolveBookArgs(db, c)
+				}
+				if err != nil {
+					return err
+				}
+
+				var page any
+				if c.IsSet("page") {
+					page = c.Int("page")
+				}
+				const QUERY = "INSERT INTO quotes (book_id, text, page, favourite, added) VALUES(?, ?, ?, ?, ?)"
+				res, err := db.Exec(QUERY, book.ID, text, page, c.Bool("favourite"), storedTime(time.Now()))
+				if err != nil {
+					return err
+				}
+				id, err := res.LastInsertId()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "INFO: added quote %d to '%s'\n", id, book.Title)
+				return nil
+			},
+		},
+		{
+			Name:      "list",
+			Usage:     "list the quotes of a book, or every quote without one",
+			Arguments: commonArgs,
+			ArgsUsage: "[[title author]|ISBN|id]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "favourites",
+					Usage: "only list favourite quotes",
+				},
+				formatFlag,
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				cfg := ctx.Value(configCtx{}).(config)
+				filter := bookFilter{}
+				if c.StringArg("title") != "" || c.Bool("ISBN") {
+					book, err := resolveBookArgs(db, c)
+					if err != nil {
+						return err
+					}
+					filter.add("book_id = ?", book.ID)
+				}
+				if c.Bool("favourites") {
+					filter.add("favourite = 1")
+				}
+				quotes, err := queryQuotes(db, filter)
+				if err != nil {
+					return err
+				}
+
+				if outputFormat(c, cfg) == "json" {
+					return printJSON(quotes)
+				}
+				for _, q := range quotes {
+					book, err := getBookByID(db, q.BookID)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("%s\n    %s by %s\n", q, book.Title, book.Author)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "favourite",
+			Usage:     "mark a quote as a favourite",
+			Arguments: quoteIDArgs,
+			ArgsUsage: "ID",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "unset",
+					Usage: "stop it being a favourite instead",
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				id, err := quoteIDArg(db, c)
+				if err != nil {
+					return err
+				}
+				_, err = db.Exec("UPDATE quotes SET favourite = ? WHERE id = ?", !c.Bool("unset"), id)
+				return err
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "remove a quote",
+			Arguments: quoteIDArgs,
+			ArgsUsage: "ID",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				id, err := quoteIDArg(db, c)
+				if err != nil {
+					return err
+				}
+				_, err = db.Exec("DELETE FROM quotes WHERE id = ?", id)
+				return err
+			},
+		},
+	},
+}
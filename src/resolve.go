@@ -0,0 +1,321 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/urfave/cli/v3"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// the most candidates listed when a query is ambiguous
+const MAX_CANDIDATES = 10
+
+// how a book was picked out on the command line. only one of the fields is
+// set, except for a lone number which is both an id and a title
+type bookQuery struct {
+	id     int64
+	isbn   string
+	title  string
+	author string
+}
+
+// reads the [[title author]|ISBN|id] arguments. the author is optional, isbns
+// need -I and #12 is always an id. a lone number is an id, or a title if no
+// book has that id, like 1984
+func bookQueryFromArgs(c *cli.Command) (bookQuery, error) {
+	first, second := c.StringArg("title"), c.StringArg("author")
+	if c.Bool("ISBN") {
+		if second != "" {
+			return bookQuery{}, errors.New("author must not be set if using ISBN mode")
+		}
+		if _, err := parseISBN(first); err != nil {
+			return bookQuery{}, err
+		}
+		return bookQuery{isbn: canonicalISBN(first)}, nil
+	}
+
+	if first == "" {
+		return bookQuery{}, errors.New("a title, an id or '-I ISBN' must be provided")
+	}
+	if rest, ok := strings.CutPrefix(first, "#"); ok && second == "" {
+		id, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil || id <= 0 {
+			return bookQuery{}, fmt.Errorf("'%s' is not a valid id", first)
+		}
+		return bookQuery{id: id}, nil
+	}
+	if id, err := strconv.ParseInt(first, 10, 64); err == nil && id > 0 && second == "" {
+		return bookQuery{id: id, title: first}, nil
+	}
+	return bookQuery{title: first, author: second}, nil
+}
+
+func (q bookQuery) String() string {
+	switch {
+	case q.id != 0 && q.title != "":
+		return fmt.Sprintf("id or title '%s'", q.title)
+	case q.id != 0:
+		return fmt.Sprintf("id '%d'", q.id)
+	case q.isbn != "":
+		return fmt.Sprintf("isbn '%s'", q.isbn)
+	case q.author == "":
+		return fmt.Sprintf("'%s'", q.title)
+	default:
+		return fmt.Sprintf("'%s' by '%s'", q.title, q.author)
+	}
+}
+
+var STRIP_MARKS = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// lowercases s and removes diacritics and punctuation, so "Rhythm Of War!"
+// and "rhythm of war" compare equal
+func normaliseName(s string) string {
+	stripped, _, err := transform.String(STRIP_MARKS, s)
+	if err != nil {
+		stripped = s
+	}
+	stripped = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		// apostrophes join words, "don't" is one word not two
+		if r == '\'' || r == '’' {
+			return -1
+		}
+		return ' '
+	}, stripped)
+	return strings.Join(strings.Fields(stripped), " ")
+}
+
+// like normaliseName but also drops a leading article
+func normaliseTitle(s string) string {
+	title := normaliseName(s)
+	for _, article := range []string{"the ", "a ", "an "} {
+		if rest, ok := strings.CutPrefix(title, article); ok && rest != "" {
+			return rest
+		}
+	}
+	return title
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// how well the normalised query matches the normalised value, lower is
+// better. exact beats a prefix, which beats a substring, which beats a typo.
+// typos are checked against the whole value and against each run of words the
+// same length as the query, so "sandersen" matches "brandon sanderson"
+func matchScore(query, value string) (int, bool) {
+	switch {
+	case query == value:
+		return 0, true
+	case strings.HasPrefix(value, query):
+		return 1, true
+	case strings.Contains(value, query):
+		return 2, true
+	}
+
+	limit := max(1, len([]rune(query))/4)
+	best := levenshtein(query, value)
+	words, n := strings.Fields(value), len(strings.Fields(query))
+	for ix := 0; ix+n <= len(words); ix++ {
+		best = min(best, levenshtein(query, strings.Join(words[ix:ix+n], " ")))
+	}
+	if best > limit {
+		return 0, false
+	}
+	return 3 + best, true
+}
+
+type bookMatch struct {
+	book  Book
+	score int
+	exact bool
+}
+
+// every book matching title and author, best first. an empty author matches
+// any author
+func rankBooks(books []Book, title, author string) []bookMatch {
+	title, author = normaliseTitle(title), normaliseName(author)
+	matches := []bookMatch{}
+	for _, book := range books {
+		titleScore, ok := matchScore(title, normaliseTitle(book.Title))
+		if !ok {
+			continue
+		}
+		authorScore := 0
+		if author != "" {
+			if authorScore, ok = matchScore(author, normaliseName(book.Author)); !ok {
+				continue
+			}
+		}
+		matches = append(matches, bookMatch{
+			book:  book,
+			score: titleScore + authorScore,
+			exact: titleScore == 0 && authorScore == 0,
+		})
+	}
+	slices.SortStableFunc(matches, func(a, b bookMatch) int { return a.score - b.score })
+	return matches
+}
+
+// an error made of msg followed by a list of the candidate books
+func candidatesError(msg string, matches []bookMatch) error {
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for ix, match := range matches {
+		if ix == MAX_CANDIDATES {
+			fmt.Fprintf(&sb, "\n  ... and %d more", len(matches)-MAX_CANDIDATES)
+			break
+		}
+		fmt.Fprintf(&sb, "\n  %4d: %s by %s (%s)", match.book.ID, match.book.Title, match.book.Author, match.book.Status)
+	}
+	return errors.New(sb.String())
+}
+
+// finds the book q refers to. ids and isbns have to match exactly, titles and
+// authors are matched loosely. a single match, or a single exact match, is
+// used and anything else is an error listing the candidates
+func resolveBook(db *sql.DB, q bookQuery) (Book, error) {
+	if q.isbn != "" {
+		return getBook(db, true, "", "", q.isbn)
+	}
+	var byID Book
+	found := false
+	if q.id != 0 {
+		book, err := getBookByID(db, q.id)
+		if q.title == "" {
+			return book, err
+		}
+		byID, found = book, err == nil
+	}
+
+	books, err := queryBooks(db, bookFilter{})
+	if err != nil {
+		return Book{}, err
+	}
+	matches := rankBooks(books, q.title, q.author)
+	exact := slices.DeleteFunc(slices.Clone(matches), func(m bookMatch) bool { return !m.exact })
+
+	// a number is an id first, unless it is also the exact title of another book
+	if found {
+		others := slices.DeleteFunc(exact, func(m bookMatch) bool { return m.book.ID == byID.ID })
+		if len(others) == 0 {
+			return byID, nil
+		}
+		msg := fmt.Sprintf("'%s' is the id of one book and the title of another, use #%s for the id or add the author for the title:", q.title, q.title)
+		return Book{}, candidatesError(msg, append([]bookMatch{{book: byID}}, others...))
+	}
+
+	switch {
+	case len(exact) == 1:
+		return exact[0].book, nil
+	case len(matches) == 1:
+		book := matches[0].book
+		fmt.Fprintf(os.Stderr, "INFO: using '%s' by '%s'\n", book.Title, book.Author)
+		return book, nil
+	case len(matches) == 0:
+		return Book{}, fmt.Errorf("no book matches %s", q)
+	default:
+		msg := fmt.Sprintf("%s matches more than one book, use its id or be more specific:", q)
+		return Book{}, candidatesError(msg, matches)
+	}
+}
+
+// the book already in the database that `start` refers to, if there is one.
+// only exact matches are used as a new book is often a prefix of one that is
+// already there, like "dune" and "dune messiah"
+func bookToStart(db *sql.DB, c *cli.Command) (Book, bool, error) {
+	q, err := bookQueryFromArgs(c)
+	if err != nil {
+		return Book{}, false, err
+	}
+	if q.id != 0 {
+		book, err := getBookByID(db, q.id)
+		if err == nil || q.title == "" {
+			return book, err == nil, err
+		}
+		// no book has the id, so the number is a title
+		q.id = 0
+	}
+
+	filter := bookFilter{}
+	if q.isbn != "" {
+		filter.add("isbn = ?", q.isbn)
+	}
+	books, err := queryBooks(db, filter)
+	if err != nil {
+		return Book{}, false, err
+	}
+	if q.isbn != "" {
+		if len(books) == 0 {
+			return Book{}, false, nil
+		}
+		return books[0], true, nil
+	}
+
+	matches := rankBooks(books, q.title, q.author)
+	exact := slices.DeleteFunc(slices.Clone(matches), func(m bookMatch) bool { return !m.exact })
+	switch {
+	case len(exact) == 1:
+		return exact[0].book, true, nil
+	case len(exact) > 1:
+		msg := fmt.Sprintf("%s matches more than one book, use its id:", q)
+		return Book{}, false, candidatesError(msg, exact)
+	case len(matches) == 0:
+		return Book{}, false, nil
+	default:
+		msg := fmt.Sprintf("%s is close to books already in the database, use an id to start one of them or --new to add it as a new book:", q)
+		return Book{}, false, candidatesError(msg, matches)
+	}
+}
+
+// marks a book that is already in the database as being read
+func startExisting(db *sql.DB, c *cli.Command, book Book) error {
+	if book.Status != BS_TBR && book.Status != BS_NONE {
+		return fmt.Errorf("'%s' can not be started, it is already %s", book.Title, book.Status)
+	}
+	started, err := flagDateEcho(c, "started")
+	if err != nil {
+		return err
+	}
+	const QUERY = "UPDATE books SET status = ?, date_started = ? WHERE id = ?"
+	_, err = db.Exec(QUERY, BS_READING, storedTime(started), book.ID)
+	return err
+}
+
+// resolves the book given in the arguments of c
+func resolveBookArgs(db *sql.DB, c *cli.Command) (Book, error) {
+	q, err := bookQueryFromArgs(c)
+	if err != nil {
+		return Book{}, err
+	}
+	return resolveBook(db, q)
+}
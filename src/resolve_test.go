@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// a new database in a temporary directory with books added in order, so the
+// first book has id 1
+func testDB(t *testing.T, books ...Book) *sql.DB {
+	t.Helper()
+	db, err := initDB(filepath.Join(t.TempDir(), "books.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, book := range books {
+		var rating any
+		if book.Rating > 0 {
+			rating = book.Rating
+		}
+		const QUERY = `INSERT INTO books (isbn, author, title, series, status, date_started, date_finished, genres, rating, title_key, author_key, series_key)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		res, err := db.Exec(QUERY, book.ISBN, book.Author, book.Title, book.Series, book.Status,
+			storedTime(book.Started), storedTime(book.Finished), strings.Join(book.Genres, ","), rating,
+			normaliseName(book.Title), normaliseName(book.Author), normaliseName(book.Series))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := setBookCredits(db, id, "author", splitAuthors(book.Author)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestResolveBook(t *testing.T) {
+	db := testDB(t,
+		Book{Title: "Dune", Author: "Frank Herbert"},
+		Book{Title: "Dune Messiah", Author: "Frank Herbert"},
+		Book{Title: "1984", Author: "George Orwell"},
+		Book{Title: "2", Author: "Someone"},
+		Book{Title: "Mort", Author: "Terry Pratchett"},
+		Book{Title: "Mort", Author: "Someone Else"},
+	)
+
+	tests := []struct {
+		name string
+		q    bookQuery
+		// the id of the book, 0 if it is an error containing err
+		want int64
+		err  string
+	}{
+		{name: "id", q: bookQuery{id: 2}, want: 2},
+		{name: "missing id", q: bookQuery{id: 99}, err: "does not exist"},
+		{name: "exact title", q: bookQuery{title: "dune"}, want: 1},
+		{name: "single loose match", q: bookQuery{title: "messiah"}, want: 2},
+		{name: "ambiguous prefix", q: bookQuery{title: "dun"}, err: "more than one book"},
+		{name: "ambiguous exact", q: bookQuery{title: "mort"}, err: "more than one book"},
+		{name: "author picks one", q: bookQuery{title: "mort", author: "pratchett"}, want: 5},
+		{name: "no match", q: bookQuery{title: "nothing like it"}, err: "no book matches"},
+		{name: "numeric title", q: bookQuery{id: 1984, title: "1984"}, want: 3},
+		{name: "number is an id", q: bookQuery{id: 1, title: "1"}, want: 1},
+		{name: "id and title", q: bookQuery{id: 2, title: "2"}, err: "use #2"},
+		{name: "explicit id", q: bookQuery{id: 2}, want: 2},
+		{name: "numeric title with author", q: bookQuery{title: "2", author: "someone"}, want: 4},
+		{name: "missing id or title", q: bookQuery{id: 77, title: "77"}, err: "no book matches id or title '77'"},
+	}
+
+	for _, test := range tests {
+		book, err := resolveBook(db, test.q)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: resolveBook(%+v) = %d, %v, want an error containing %q", test.name, test.q, book.ID, err, test.err)
+			}
+			continue
+		}
+		if err != nil || book.ID != test.want {
+			t.Errorf("%s: resolveBook(%+v) = %d, %v, want %d", test.name, test.q, book.ID, err, test.want)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		query, value string
+		want         int
+		ok           bool
+	}{
+		{"dune", "dune", 0, true},
+		{"dune", "dune messiah", 1, true},
+		{"messiah", "dune messiah", 2, true},
+		{"sandersen", "brandon sanderson", 4, true},
+		{"dune", "mort", 0, false},
+		{"1984", "1985", 4, true},
+		{"1984", "2001", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := matchScore(test.query, test.value)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("matchScore(%q, %q) = %d, %v, want %d, %v", test.query, test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+type reviewBook struct {
+	Book
+	// the small cover copied next to the markdown, relative to it
+	CoverFile string
+	// the same cover as a data url so the html needs nothing else
+	CoverData htmltemplate.URL
+	cover     []byte
+}
+
+type reviewMonth struct {
+	Name  string
+	Books []reviewBook
+}
+
+// a favourite quote and the book it is from
+type reviewQuote struct {
+	quote
+	Title  string
+	Author string
+}
+
+// how many of the best rated books a review shows
+const REVIEW_BEST_RATED = 5
+
+// everything a year in review shows
+type yearReview struct {
+	Year   int
+	Stats  readingStats
+	Goal   *goalStatus
+	Months []reviewMonth
+	// every genre, not just the top ones
+	Genres []statsCount
+	// the highest rated books finished in the year, best first
+	BestRated []Book
+	// the favourite quotes of the books finished in the year
+	Quotes []reviewQuote
+}
+
+func (r yearReview) Fastest() *statsRead {
+	if len(r.Stats.Shortest) == 0 {
+		return nil
+	}
+	return &r.Stats.Shortest[0]
+}
+
+func (r yearReview) Longest() *statsRead {
+	if len(r.Stats.Longest) == 0 {
+		return nil
+	}
+	return &r.Stats.Longest[0]
+}
+
+// backslash escapes everything markdown could read as formatting, so a title
+// like *NSYNC shows as it is and a | can not break the genre table
+var MARKDOWN_ESCAPER = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "|", `\|`,
+	"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+)
+
+const REVIEW_MARKDOWN = `# {{.Year}} in books
+
+- **{{.Stats.Finished}}** books finished{{if .Stats.DNF}}, {{.Stats.DNF}} put down{{end}}
+{{- with .Goal}}
+- {{.Finished}} of a {{.Target}} book goal{{if ge .Finished .Target}}, goal met{{end}}
+{{- if .PagesTarget}}
+- {{.Pages}} of a {{.PagesTarget}} page goal{{if ge .Pages .PagesTarget}}, goal met{{end}}
+{{- end}}
+{{- end}}
+{{- if .Stats.AverageDays}}
+- {{.Stats.AverageDays}} days to finish a book on average, {{.Stats.MedianDays}} days median
+{{- end}}
+{{- with .Fastest}}
+- fastest read: *{{md .Title}}* by {{md .Author}} in {{.Days}} days
+{{- end}}
+{{- with .Longest}}
+- longest read (days): *{{md .Title}}* by {{md .Author}} over {{.Days}} days
+{{- end}}
+{{- if .BestRated}}
+
+## Best rated
+{{range .BestRated}}
+- {{stars .Rating}} **{{md .Title}}** by {{md .Author}}
+{{- end}}
+{{- end}}
+{{- if .Quotes}}
+
+## Favourite quotes
+{{range $ix, $_ := .Quotes}}{{if $ix}}
+{{end}}
+> {{md .Text | quoted}}
+>
+> — *{{md .Title}}* by {{md .Author}}{{if .Page}}, page {{.Page}}{{end}}
+{{- end}}
+{{- end}}
+{{- if .Genres}}
+
+## Genres
+
+| Genre | Books |
+| --- | ---: |
+{{- range .Genres}}
+| {{md .Name}} | {{.Count}} |
+{{- end}}
+{{- end}}
+
+## Month by month
+{{range .Months}}
+### {{.Name}}
+{{range .Books}}
+- {{if .CoverFile}}<img src="{{.CoverFile}}" height="60"> {{end}}**{{md .Title}}** by {{md .Author}}
+{{- end}}
+{{end -}}
+`
+
+const REVIEW_HTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Year}} in books</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+h1 { font-size: 2.5rem; }
+.totals { display: flex; flex-wrap: wrap; gap: 1rem; padding: 0; list-style: none; }
+.totals li { background: #f3f3f3; border-radius: .5rem; padding: .75rem 1rem; }
+.totals b { display: block; font-size: 1.75rem; }
+table { border-collapse: collapse; }
+td, th { padding: .25rem .75rem; border-bottom: 1px solid #ddd; text-align: left; }
+td.count { text-align: right; }
+.books { display: flex; flex-wrap: wrap; gap: 1rem; padding: 0; list-style: none; }
+.books li { width: 8rem; font-size: .9rem; }
+.books img { width: 100%; border-radius: .25rem; display: block; margin-bottom: .25rem; }
+blockquote { margin: 1rem 0; padding-left: 1rem; border-left: .25rem solid #ddd; }
+</style>
+</head>
+<body>
+<h1>{{.Year}} in books</h1>
+<ul class="totals">
+<li><b>{{.Stats.Finished}}</b>books finished</li>
+{{- if .Stats.DNF}}
+<li><b>{{.Stats.DNF}}</b>put down</li>
+{{- end}}
+{{- with .Goal}}
+<li><b>{{.Finished}}/{{.Target}}</b>goal{{if ge .Finished .Target}} met{{end}}</li>
+{{- if .PagesTarget}}
+<li><b>{{.Pages}}/{{.PagesTarget}}</b>pages goal{{if ge .Pages .PagesTarget}} met{{end}}</li>
+{{- end}}
+{{- end}}
+{{- if .Stats.AverageDays}}
+<li><b>{{.Stats.AverageDays}}</b>days per book on average</li>
+{{- end}}
+</ul>
+{{- with .Fastest}}
+<p>Fastest read: <i>{{.Title}}</i> by {{.Author}} in {{.Days}} days</p>
+{{- end}}
+{{- with .Longest}}
+<p>Longest read (days): <i>{{.Title}}</i> by {{.Author}} over {{.Days}} days</p>
+{{- end}}
+{{- if .BestRated}}
+<h2>Best rated</h2>
+<ol>
+{{- range .BestRated}}
+<li>{{stars .Rating}} <b>{{.Title}}</b> by {{.Author}}</li>
+{{- end}}
+</ol>
+{{- end}}
+{{- if .Quotes}}
+<h2>Favourite quotes</h2>
+{{- range .Quotes}}
+<blockquote><p>{{.Text}}</p><footer>— <i>{{.Title}}</i> by {{.Author}}{{if .Page}}, page {{.Page}}{{end}}</footer></blockquote>
+{{- end}}
+{{- end}}
+{{- if .Genres}}
+<h2>Genres</h2>
+<table>
+<tr><th>Genre</th><th>Books</th></tr>
+{{- range .Genres}}
+<tr><td>{{.Name}}</td><td class="count">{{.Count}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>Month by month</h2>
+{{- range .Months}}
+<h3>{{.Name}}</h3>
+<ul class="books">
+{{- range .Books}}
+<li>{{if .CoverData}}<img src="{{.CoverData}}" alt="">{{end}}<b>{{.Title}}</b><br>{{.Author}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`
+
+// the small cover of a book, nil if it has none
+func reviewCover(book Book) []byte {
+	if book.CoverPath == "" {
+		return nil
+	}
+	path, err := coverFile(book, "S")
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// copies the covers into dir so the markdown can link to them without
+// pointing into the data directory
+func copyReviewCovers(review yearReview, dir string) error {
+	for _, month := range review.Months {
+		for ix, book := range month.Books {
+			if book.cover == nil {
+				continue
+			}
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				return err
+			}
+			name := fmt.Sprintf("%d.jpg", book.ID)
+			if err := os.WriteFile(filepath.Join(dir, name), book.cover, 0o644); err != nil {
+				return err
+			}
+			month.Books[ix].CoverFile = path.Join(filepath.Base(dir), name)
+		}
+	}
+	return nil
+}
+
+func buildReview(db *sql.DB, year int, now time.Time) (yearReview, error) {
+	books, err := statsBooks(db, year)
+	if err != nil {
+		return yearReview{}, err
+	}
+	review := yearReview{Year: year, Stats: computeStats(books, year)}
+
+	if target, err := getGoal(db, year); err == nil {
+		goal, err := computeGoal(db, year, target, now)
+		if err != nil {
+			return yearReview{}, err
+		}
+		review.Goal = &goal
+	}
+
+	genres := map[string]int{}
+	byMonth := map[time.Month][]reviewBook{}
+	for _, book := range books {
+		if book.Status != BS_FINISHED {
+			continue
+		}
+		for _, genre := range book.Genres {
+			genres[genre]++
+		}
+		if book.Rating > 0 {
+			review.BestRated = append(review.BestRated, book)
+		}
+		quotes, err := bookQuotes(db, book.ID)
+		if err != nil {
+			return yearReview{}, err
+		}
+		for _, q := range quotes {
+			if q.Favourite {
+				review.Quotes = append(review.Quotes, reviewQuote{q, book.Title, book.Author})
+			}
+		}
+		month := book.Finished.In(time.Local).Month()
+		entry := reviewBook{Book: book, cover: reviewCover(book)}
+		if entry.cover != nil {
+			entry.CoverData = htmltemplate.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(entry.cover))
+		}
+		byMonth[month] = append(byMonth[month], entry)
+	}
+	review.Genres = topCounts(genres, len(genres))
+	// stable so books with the same rating stay in the order they were finished
+	slices.SortStableFunc(review.BestRated, func(a, b Book) int { return b.Rating - a.Rating })
+	review.BestRated = review.BestRated[:min(REVIEW_BEST_RATED, len(review.BestRated))]
+	for month := time.January; month <= time.December; month++ {
+		if len(byMonth[month]) > 0 {
+			review.Months = append(review.Months, reviewMonth{month.String(), byMonth[month]})
+		}
+	}
+	return review, nil
+}
+
+var reviewYearCmd = &cli.Command{
+	Name:      "review-year",
+	Usage:     "write a year in review as markdown and as a single html file",
+	Arguments: []cli.Argument{&cli.IntArg{Name: "year"}},
+	ArgsUsage: "YEAR",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "output",
+			Aliases:     []string{"o"},
+			Usage:       "the `path` to write to, .md and .html are added to it and covers go in path-covers",
+			DefaultText: "review-YEAR in the current directory",
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "overwrite a review that is already there",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		year := int(c.IntArg("year"))
+		if year <= 0 {
+			return errors.New("a year must be provided, like: review-year 2026")
+		}
+		db := ctx.Value(myCtx{}).(*sql.DB)
+		review, err := buildReview(db, year, time.Now())
+		if err != nil {
+			return err
+		}
+		if review.Stats.Finished == 0 {
+			fmt.Fprintf(os.Stderr, "WARN: no books were finished in %d\n", year)
+		}
+
+		output := c.String("output")
+		if output == "" {
+			output = "review-" + strconv.Itoa(year)
+		}
+
+		coverDir := output + "-covers"
+		if !c.Bool("force") {
+			for _, file := range []string{output + ".md", output + ".html", coverDir} {
+				if _, err := os.Stat(file); err == nil {
+					return fmt.Errorf("'%s' already exists, use --force to overwrite it", file)
+				}
+			}
+		}
+		if err := copyReviewCovers(review, coverDir); err != nil {
+			return err
+		}
+
+		var markdown, html bytes.Buffer
+		funcs := template.FuncMap{
+			"md":    MARKDOWN_ESCAPER.Replace,
+			"stars": ratingStars,
+			// keeps every line of a quote inside the blockquote
+			"quoted": func(s string) string { return strings.ReplaceAll(s, "\n", "\n> ") },
+		}
+		if err := template.Must(template.New("md").Funcs(funcs).Parse(REVIEW_MARKDOWN)).Execute(&markdown, review); err != nil {
+			return err
+		}
+		htmlFuncs := htmltemplate.FuncMap{"stars": ratingStars}
+		if err := htmltemplate.Must(htmltemplate.New("html").Funcs(htmlFuncs).Parse(REVIEW_HTML)).Execute(&html, review); err != nil {
+			return err
+		}
+		for _, file := range []struct {
+			path string
+			data []byte
+		}{{output + ".md", markdown.Bytes()}, {output + ".html", html.Bytes()}} {
+			if err := os.WriteFile(file.path, file.data, 0o644); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "INFO: wrote '%s'\n", file.path)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// books.series holds the name of a books series, the triggers make sure every
+// name used has a row here. length is how many books the series has, if known,
+// so missing books after the last one you have can be shown
+var CREATESERIESQUERIES = []string{
+	`CREATE TABLE series (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		length INTEGER
+	);`,
+	`CREATE TRIGGER series_insert AFTER INSERT ON books WHEN COALESCE(new.series, '') != '' BEGIN
+		INSERT OR IGNORE INTO series (name) VALUES (new.series);
+	END;`,
+	`CREATE TRIGGER series_update AFTER UPDATE OF series ON books WHEN COALESCE(new.series, '') != '' BEGIN
+		INSERT OR IGNORE INTO series (name) VALUES (new.series);
+	END;`,
+}
+
+// series are matched on name_key from migration 9, so "the stormlight archive"
+// is the same series as "The Stormlight Archive". these replace the triggers
+// from CREATESERIESQUERIES
+var SERIESKEYQUERIES = []string{
+	"ALTER TABLE series ADD COLUMN name_key TEXT NOT NULL DEFAULT ''",
+	"DROP TRIGGER series_insert",
+	"DROP TRIGGER series_update",
+	`CREATE TRIGGER series_insert AFTER INSERT ON books WHEN new.series_key != '' BEGIN
+		INSERT INTO series (name, name_key) SELECT new.series, new.series_key
+		WHERE NOT EXISTS (SELECT 1 FROM series WHERE name_key = new.series_key);
+	END;`,
+	`CREATE TRIGGER series_update AFTER UPDATE OF series_key ON books WHEN new.series_key != '' BEGIN
+		INSERT INTO series (name, name_key) SELECT new.series, new.series_key
+		WHERE NOT EXISTS (SELECT 1 FROM series WHERE name_key = new.series_key);
+	END;`,
+}
+
+// a series goes once its last book is deleted or moved to another series, so
+// it leaves `series list` and `series next`
+var SERIESCLEANUPQUERIES = []string{
+	`CREATE TRIGGER series_cleanup_update AFTER UPDATE OF series_key ON books WHEN old.series_key != '' BEGIN
+		DELETE FROM series WHERE name_key = old.series_key
+		AND NOT EXISTS (SELECT 1 FROM books WHERE series_key = old.series_key);
+	END;`,
+	`CREATE TRIGGER series_cleanup_delete AFTER DELETE ON books WHEN old.series_key != '' BEGIN
+		DELETE FROM series WHERE name_key = old.series_key
+		AND NOT EXISTS (SELECT 1 FROM books WHERE series_key = old.series_key);
+	END;`,
+	"DELETE FROM series WHERE NOT EXISTS (SELECT 1 FROM books WHERE series_key = series.name_key)",
+}
+
+// a zero position is stored as NULL
+func storedPosition(position float64) any {
+	if position == 0 {
+		return nil
+	}
+	return position
+}
+
+// 2 or 2.5, never 2.000000
+func formatPosition(position float64) string {
+	return strconv.FormatFloat(position, 'f', -1, 64)
+}
+
+type seriesInfo struct {
+	Name   string `json:"name"`
+	Length int    `json:"length,omitempty"`
+}
+
+// a place in a series, either a book or a gap where a book is missing
+type seriesSlot struct {
+	Position float64 `json:"position,omitempty"`
+	// read, reading, dnf, tbr or missing
+	Mark string `json:"mark"`
+	Book *Book  `json:"book,omitempty"`
+}
+
+func seriesMark(status BookState) string {
+	switch status {
+	case BS_FINISHED:
+		return "read"
+	case BS_READING:
+		return "reading"
+	case BS_DNF:
+		return "dnf"
+	default:
+		return "tbr"
+	}
+}
+
+func allSeries(db *sql.DB) ([]seriesInfo, error) {
+	rows, err := db.Query("SELECT name, COALESCE(length, 0) FROM series ORDER BY name_key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []seriesInfo{}
+	for rows.Next() {
+		var s seriesInfo
+		if err := rows.Scan(&s.Name, &s.Length); err != nil {
+			return nil, err
+		}
+		series = append(series, s)
+	}
+	return series, rows.Err()
+}
+
+// finds a series by name, loosely like books are found
+func resolveSeries(db *sql.DB, name string) (seriesInfo, error) {
+	all, err := allSeries(db)
+	if err != nil {
+		return seriesInfo{}, err
+	}
+
+	query := normaliseTitle(name)
+	matches := []seriesInfo{}
+	for _, s := range all {
+		score, ok := matchScore(query, normaliseTitle(s.Name))
+		if score == 0 && ok {
+			return s, nil
+		}
+		if ok {
+			matches = append(matches, s)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return seriesInfo{}, fmt.Errorf("series '%s' does not exist", name)
+	case 1:
+		return matches[0], nil
+	default:
+		names := []string{}
+		for _, s := range matches {
+			names = append(names, s.Name)
+		}
+		return seriesInfo{}, fmt.Errorf("'%s' matches more than one series: '%s'", name, strings.Join(names, "' '"))
+	}
+}
+
+// the books of a series in order with gaps filled in as missing, books without
+// a position go at the end
+func seriesSlots(db *sql.DB, s seriesInfo) ([]seriesSlot, error) {
+	filter := bookFilter{}
+	filter.add("series_key = ?", normaliseName(s.Name))
+	books, err := queryBooks(db, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	have := map[float64]bool{}
+	last := float64(s.Length)
+	for _, book := range books {
+		have[book.SeriesPosition] = true
+		last = max(last, book.SeriesPosition)
+	}
+
+	slots := []seriesSlot{}
+	for ix := range books {
+		slots = append(slots, seriesSlot{books[ix].SeriesPosition, seriesMark(books[ix].Status), &books[ix]})
+	}
+	// only whole numbers can be missing, novellas are optional
+	for position := 1.0; position <= math.Floor(last); position++ {
+		if !have[position] {
+			slots = append(slots, seriesSlot{Position: position, Mark: "missing"})
+		}
+	}
+
+	// unpositioned books sort last
+	key := func(slot seriesSlot) float64 {
+		if slot.Position == 0 {
+			return math.Inf(1)
+		}
+		return slot.Position
+	}
+	slices.SortStableFunc(slots, func(a, b seriesSlot) int { return cmp.Compare(key(a), key(b)) })
+	return slots, nil
+}
+
+// the first book, or missing gap, after the furthest book that has been
+// started. false if there is nothing after it or nothing has been started
+func nextInSeries(slots []seriesSlot) (seriesSlot, bool) {
+	started, furthest := false, 0.0
+	for _, slot := range slots {
+		if slot.Book != nil && (slot.Mark == "read" || slot.Mark == "reading" || slot.Mark == "dnf") {
+			started = true
+			furthest = max(furthest, slot.Position)
+		}
+	}
+	if !started {
+		return seriesSlot{}, false
+	}
+	for _, slot := range slots {
+		if slot.Position > furthest && (slot.Mark == "tbr" || slot.Mark == "missing") {
+			return slot, true
+		}
+	}
+	return seriesSlot{}, false
+}
+
+func (slot seriesSlot) String() string {
+	position := "?"
+	if slot.Position != 0 {
+		position = "#" + formatPosition(slot.Position)
+	}
+	title := "--"
+	if slot.Book != nil {
+		title = slot.Book.Title
+	}
+	return fmt.Sprintf("%-6s %-8s %s", position, slot.Mark, title)
+}
+
+var seriesCmd = &cli.Command{
+	Name:  "series",
+	Usage: "see which books of a series you have read and which are missing",
+	Commands: []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "list every series",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				all, err := allSeries(db)
+				if err != nil {
+					return err
+				}
+				for _, s := range all {
+					slots, err := seriesSlots(db, s)
+					if err != nil {
+						return err
+					}
+					read, owned := 0, 0
+					for _, slot := range slots {
+						if slot.Book != nil {
+							owned++
+						}
+						if slot.Mark == "read" {
+							read++
+						}
+					}
+					fmt.Printf("%s (%d of %d read)\n", s.Name, read, owned)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "show",
+			Usage:     "show a series in order, marking what has been read and what is missing",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Flags:     []cli.Flag{formatFlag},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				cfg := ctx.Value(configCtx{}).(config)
+				s, err := resolveSeries(db, c.StringArg("name"))
+				if err != nil {
+					return err
+				}
+				slots, err := seriesSlots(db, s)
+				if err != nil {
+					return err
+				}
+
+				if outputFormat(c, cfg) == "json" {
+					return printJSON(struct {
+						seriesInfo
+						Books []seriesSlot `json:"books"`
+					}{s, slots})
+				}
+				fmt.Println(s.Name)
+				for _, slot := range slots {
+					fmt.Printf("  %s\n", slot)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "set",
+			Usage:     "set details about a series",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  "length",
+					Usage: "how many `books` are in the series, 0 if it is not known",
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				if !c.IsSet("length") {
+					return errors.New("nothing to set, use --length")
+				}
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				s, err := resolveSeries(db, c.StringArg("name"))
+				if err != nil {
+					return err
+				}
+				var length any
+				if c.Int("length") > 0 {
+					length = c.Int("length")
+				}
+				_, err = db.Exec("UPDATE series SET length = ? WHERE name = ?", length, s.Name)
+				return err
+			},
+		},
+	},
+}
+
+var nextCmd = &cli.Command{
+	Name:  "next",
+	Usage: "list the next book to read in every series you have started",
+	Action: func(ctx context.Context, c *cli.Command) error {
+		db := ctx.Value(myCtx{}).(*sql.DB)
+		all, err := allSeries(db)
+		if err != nil {
+			return err
+		}
+
+		width := 0
+		for _, s := range all {
+			width = max(width, len(s.Name))
+		}
+		for _, s := range all {
+			slots, err := seriesSlots(db, s)
+			if err != nil {
+				return err
+			}
+			if next, ok := nextInSeries(slots); ok {
+				fmt.Printf("%-*s  %s\n", width, s.Name, next)
+			}
+		}
+		return nil
+	},
+}
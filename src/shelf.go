@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+)
+
+// a shelf is a saved --where expression, so it always shows the books that
+// currently match it
+type shelf struct {
+	Name  string `json:"name"`
+	Where string `json:"where"`
+}
+
+func getShelf(db *sql.DB, name string) (shelf, error) {
+	const QUERY = "SELECT name, filter FROM shelves WHERE name = ?"
+	var s shelf
+	err := db.QueryRow(QUERY, name).Scan(&s.Name, &s.Where)
+	if errors.Is(err, sql.ErrNoRows) {
+		return shelf{}, fmt.Errorf("shelf '%s' does not exist", name)
+	}
+	return s, err
+}
+
+func allShelves(db *sql.DB) ([]shelf, error) {
+	rows, err := db.Query("SELECT name, filter FROM shelves ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shelves := []shelf{}
+	for rows.Next() {
+		var s shelf
+		if err := rows.Scan(&s.Name, &s.Where); err != nil {
+			return nil, err
+		}
+		shelves = append(shelves, s)
+	}
+	return shelves, rows.Err()
+}
+
+// adds the shelf called name to filter
+func addShelfFilter(db *sql.DB, filter *bookFilter, name string) error {
+	s, err := getShelf(db, name)
+	if err != nil {
+		return err
+	}
+	where, args, err := parseWhere(s.Where)
+	if err != nil {
+		return fmt.Errorf("shelf '%s': %w", name, err)
+	}
+	filter.add("("+where+")", args...)
+	return nil
+}
+
+var shelfCmd = &cli.Command{
+	Name:  "shelf",
+	Usage: "save --where filters under a name, use them with `list --shelf`",
+	Commands: []*cli.Command{
+		{
+			Name:  "save",
+			Usage: "save a filter as a shelf, replacing it if it already exists",
+			Arguments: []cli.Argument{
+				&cli.StringArg{Name: "name"},
+				&cli.StringArg{Name: "filter"},
+			},
+			ArgsUsage: "NAME FILTER",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				name, filter := c.StringArg("name"), c.StringArg("filter")
+				if name == "" || filter == "" {
+					return errors.New("a shelf name and a filter must be provided, like: shelf save fantasy 'genre:fantasy'")
+				}
+				if _, _, err := parseWhere(filter); err != nil {
+					return err
+				}
+
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				if _, err := getShelf(db, name); err == nil {
+					fmt.Fprintf(os.Stderr, "INFO: replacing shelf '%s'\n", name)
+				}
+				const QUERY = `INSERT INTO shelves (name, filter) VALUES(?, ?)
+					ON CONFLICT (name) DO UPDATE SET filter = excluded.filter`
+				_, err := db.Exec(QUERY, name, filter)
+				return err
+			},
+		},
+		{
+			Name:  "list",
+			Usage: "list every shelf and how many books are on it",
+			Flags: []cli.Flag{formatFlag},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				cfg := ctx.Value(configCtx{}).(config)
+				shelves, err := allShelves(db)
+				if err != nil {
+					return err
+				}
+				if outputFormat(c, cfg) == "json" {
+					return printJSON(shelves)
+				}
+
+				width := 0
+				for _, s := range shelves {
+					width = max(width, len(s.Name))
+				}
+				for _, s := range shelves {
+					filter := bookFilter{}
+					if err := addShelfFilter(db, &filter, s.Name); err != nil {
+						return err
+					}
+					books, err := queryBooks(db, filter)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("%-*s  %4d books  %s\n", width, s.Name, len(books), s.Where)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "remove a shelf, the books on it are left alone",
+			Arguments: []cli.Argument{&cli.StringArg{Name: "name"}},
+			ArgsUsage: "NAME",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				db := ctx.Value(myCtx{}).(*sql.DB)
+				name := c.StringArg("name")
+				if _, err := getShelf(db, name); err != nil {
+					return err
+				}
+				_, err := db.Exec("DELETE FROM shelves WHERE name = ?", name)
+				return err
+			},
+		},
+	},
+}
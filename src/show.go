@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// a cached provider response for a books isbn, this is where enrich and
+// search got their metadata from
+type metadataSource struct {
+	Provider  string    `json:"provider"`
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Stale     bool      `json:"stale"`
+}
+
+// everything `show` knows about a book
+type bookDetails struct {
+	Book
+	Took    string   `json:"took,omitempty"`
+	Credits []credit `json:"credits,omitempty"`
+	// the days in the reading log, oldest first
+	ReadOn   []string         `json:"read_on,omitempty"`
+	Progress []progressEntry  `json:"progress,omitempty"`
+	Quotes   []quote          `json:"quotes,omitempty"`
+	Cover    string           `json:"cover,omitempty"`
+	Metadata []metadataSource `json:"metadata,omitempty"`
+}
+
+func metadataSources(db *sql.DB, isbn string) ([]metadataSource, error) {
+	sources := []metadataSource{}
+	if isbn == "" {
+		return sources, nil
+	}
+	for _, name := range PROVIDER_ORDER {
+		entry, err := cacheGet(db, name, "isbn:"+isbn)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		sources = append(sources, metadataSource{
+			Provider:  entry.provider,
+			URL:       entry.url,
+			FetchedAt: entry.fetchedAt,
+			Stale:     !entry.fresh(),
+		})
+	}
+	return sources, nil
+}
+
+func bookReadingDays(db *sql.DB, id int64) ([]string, error) {
+	rows, err := db.Query("SELECT day FROM reading_log WHERE book_id = ? ORDER BY day", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []string{}
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+func getBookByID(db *sql.DB, id int64) (Book, error) {
+	filter := bookFilter{}
+	filter.add("id = ?", id)
+	books, err := queryBooks(db, filter)
+	if err != nil {
+		return Book{}, err
+	}
+	if len(books) == 0 {
+		return Book{}, fmt.Errorf("book with id: '%d' does not exist", id)
+	}
+	return books[0], nil
+}
+
+// a rating out of 5 as stars
+func ratingStars(rating int) string {
+	return strings.Repeat("★", rating) + strings.Repeat("☆", 5-rating)
+}
+
+func (d *bookDetails) Format(dateFormat string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "ID      : %d\n", d.ID)
+	sb.WriteString(d.Book.Format(dateFormat))
+	if d.ISBNOriginal != "" && d.ISBNOriginal != d.ISBN {
+		fmt.Fprintf(&sb, "Entered : %s\n", d.ISBNOriginal)
+	}
+	pages := "--"
+	if d.Pages > 0 {
+		pages = strconv.Itoa(d.Pages)
+	}
+	fmt.Fprintf(&sb, "Pages   : %s\n", pages)
+
+	credits := []string{}
+	for _, cr := range d.Credits {
+		if cr.Role != "author" {
+			credits = append(credits, fmt.Sprintf("%s (%s)", cr.Name, cr.Role))
+		}
+	}
+	if len(credits) > 0 {
+		fmt.Fprintf(&sb, "Credits : %s\n", strings.Join(credits, ", "))
+	}
+
+	rating := "--"
+	if d.Rating > 0 {
+		rating = ratingStars(d.Rating)
+	}
+	fmt.Fprintf(&sb, "Rating  : %s\n", rating)
+	if d.Review != "" {
+		// later lines of a review line up under the first
+		fmt.Fprintf(&sb, "Review  : %s\n", strings.ReplaceAll(d.Review, "\n", "\n          "))
+	}
+
+	readOn := "--"
+	if len(d.ReadOn) > 0 {
+		readOn = fmt.Sprintf("%s, last on %s", pluralDays(len(d.ReadOn)), d.ReadOn[len(d.ReadOn)-1])
+	}
+	fmt.Fprintf(&sb, "Read on : %s\n", readOn)
+
+	if len(d.Progress) == 0 {
+		fmt.Fprintf(&sb, "Progress: --\n")
+	}
+	for ix, entry := range d.Progress {
+		label := "Progress:"
+		if ix > 0 {
+			label = "         "
+		}
+		fmt.Fprintf(&sb, "%s %s\n", label, entry)
+	}
+
+	if len(d.Quotes) == 0 {
+		fmt.Fprintf(&sb, "Quotes  : --\n")
+	}
+	for ix, q := range d.Quotes {
+		label := "Quotes  :"
+		if ix > 0 {
+			label = "         "
+		}
+		fmt.Fprintf(&sb, "%s %s\n", label, strings.ReplaceAll(q.String(), "\n", "\n          "))
+	}
+
+	cover := d.Cover
+	if cover == "" {
+		cover = "--"
+	}
+	fmt.Fprintf(&sb, "Cover   : %s\n", cover)
+
+	if len(d.Metadata) == 0 {
+		fmt.Fprintf(&sb, "Metadata: --\n")
+	}
+	for ix, source := range d.Metadata {
+		label := "Metadata:"
+		if ix > 0 {
+			label = "         "
+		}
+		stale := ""
+		if source.Stale {
+			stale = " (stale)"
+		}
+		fmt.Fprintf(&sb, "%s %s, fetched %s%s\n", label, source.Provider, source.FetchedAt.Format(dateFormat), stale)
+	}
+	return sb.String()
+}
+
+var showCmd = &cli.Command{
+	Name:      "show",
+	Usage:     "show everything about one book",
+	Arguments: commonArgs,
+	ArgsUsage: "[[title author]|ISBN|id]",
+	Flags:     []cli.Flag{isbnFlag, formatFlag},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		db := ctx.Value(myCtx{}).(*sql.DB)
+		cfg := ctx.Value(configCtx{}).(config)
+
+		book, err := resolveBookArgs(db, c)
+		if err != nil {
+			return err
+		}
+
+		details := bookDetails{Book: book}
+		if book.Took != 0 {
+			details.Took = humanDuration(book.Took)
+		}
+		if book.CoverPath != "" {
+			if details.Cover, err = coverFile(book, "L"); err != nil {
+				return err
+			}
+		}
+		if details.Credits, err = bookCredits(db, book.ID); err != nil {
+			return err
+		}
+		if details.ReadOn, err = bookReadingDays(db, book.ID); err != nil {
+			return err
+		}
+		if details.Progress, err = bookProgress(db, book.ID); err != nil {
+			return err
+		}
+		if details.Quotes, err = bookQuotes(db, book.ID); err != nil {
+			return err
+		}
+		if details.Metadata, err = metadataSources(db, book.ISBN); err != nil {
+			return err
+		}
+
+		if outputFormat(c, cfg) == "json" {
+			return printJSON(details)
+		}
+		fmt.Print(details.Format(cfg.defaults.dateFormat))
+		return nil
+	},
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// how many genres, authors and reads are shown in each top list
+const STATS_TOP = 5
+
+type statsCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type statsRead struct {
+	ID     int64   `json:"id"`
+	Title  string  `json:"title"`
+	Author string  `json:"author"`
+	Days   float64 `json:"days"`
+}
+
+type readingStats struct {
+	Year        int     `json:"year,omitempty"`
+	Finished    int     `json:"finished"`
+	DNF         int     `json:"dnf"`
+	DNFRate     float64 `json:"dnf_rate"`
+	AverageDays float64 `json:"average_days"`
+	MedianDays  float64 `json:"median_days"`
+	// the pages of the finished books with a page count
+	Pages int `json:"pages"`
+	// how many finished books have no page count
+	PagesUnknown int          `json:"pages_unknown"`
+	ByYear       []statsCount `json:"by_year"`
+	ByMonth      []statsCount `json:"by_month"`
+	TopGenres    []statsCount `json:"top_genres"`
+	TopAuthors   []statsCount `json:"top_authors"`
+	Longest      []statsRead  `json:"longest"`
+	Shortest     []statsRead  `json:"shortest"`
+	// streaks are over every year even when Year is set
+	CurrentStreak streak `json:"current_streak"`
+	LongestStreak streak `json:"longest_streak"`
+}
+
+func days(d time.Duration) float64 {
+	return math.Round(d.Hours()/24*10) / 10
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Sorted(slices.Values(values))
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return math.Round((sorted[mid-1]+sorted[mid])/2*10) / 10
+}
+
+// counts sorted by most first then by name, cut to the top n
+func topCounts(counts map[string]int, n int) []statsCount {
+	top := []statsCount{}
+	for name, count := range counts {
+		top = append(top, statsCount{name, count})
+	}
+	slices.SortFunc(top, func(a, b statsCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Name, b.Name))
+	})
+	return top[:min(n, len(top))]
+}
+
+// the finished and dnf books, only those finished in year unless it is 0
+func statsBooks(db *sql.DB, year int) ([]Book, error) {
+	filter := bookFilter{}
+	filter.add("status IN (?, ?) AND date_finished IS NOT NULL", BS_FINISHED, BS_DNF)
+	if year != 0 {
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+		filter.add("unixepoch(date_finished) >= ? AND unixepoch(date_finished) < ?", start.Unix(), start.AddDate(1, 0, 0).Unix())
+	}
+	return queryBooks(db, filter)
+}
+
+// works out the stats for books, which should come from statsBooks
+func computeStats(books []Book, year int) readingStats {
+	stats := readingStats{Year: year}
+	byYear, byMonth := map[string]int{}, map[string]int{}
+	genres, authors := map[string]int{}, map[string]int{}
+	// the first spelling of an author is the one shown
+	authorNames := map[string]string{}
+	reads := []statsRead{}
+	took := []float64{}
+
+	if year != 0 {
+		for month := time.January; month <= time.December; month++ {
+			byMonth[fmt.Sprintf("%d-%02d", year, month)] = 0
+		}
+	}
+
+	for _, book := range books {
+		if book.Status == BS_DNF {
+			stats.DNF++
+			continue
+		}
+		stats.Finished++
+		if book.Pages > 0 {
+			stats.Pages += book.Pages
+		} else {
+			stats.PagesUnknown++
+		}
+		finished := book.Finished.In(time.Local)
+		byYear[strconv.Itoa(finished.Year())]++
+		byMonth[finished.Format("2006-01")]++
+		for _, genre := range book.Genres {
+			genres[genre]++
+		}
+		for _, author := range splitAuthors(book.Author) {
+			key := normaliseName(author)
+			if _, ok := authorNames[key]; !ok {
+				authorNames[key] = author
+			}
+			authors[authorNames[key]]++
+		}
+		if book.Took > 0 {
+			took = append(took, days(book.Took))
+			reads = append(reads, statsRead{book.ID, book.Title, book.Author, days(book.Took)})
+		}
+	}
+
+	if total := stats.Finished + stats.DNF; total > 0 {
+		stats.DNFRate = math.Round(float64(stats.DNF)/float64(total)*1000) / 1000
+	}
+	if len(took) > 0 {
+		sum := 0.0
+		for _, d := range took {
+			sum += d
+		}
+		stats.AverageDays = math.Round(sum/float64(len(took))*10) / 10
+		stats.MedianDays = median(took)
+	}
+
+	// years and months are in order, not by count
+	stats.ByYear = topCounts(byYear, len(byYear))
+	slices.SortFunc(stats.ByYear, func(a, b statsCount) int { return strings.Compare(a.Name, b.Name) })
+	stats.ByMonth = topCounts(byMonth, len(byMonth))
+	slices.SortFunc(stats.ByMonth, func(a, b statsCount) int { return strings.Compare(a.Name, b.Name) })
+	stats.TopGenres = topCounts(genres, STATS_TOP)
+	stats.TopAuthors = topCounts(authors, STATS_TOP)
+
+	slices.SortStableFunc(reads, func(a, b statsRead) int { return cmp.Compare(b.Days, a.Days) })
+	stats.Longest = slices.Clone(reads[:min(STATS_TOP, len(reads))])
+	slices.Reverse(reads)
+	stats.Shortest = reads[:min(STATS_TOP, len(reads))]
+	return stats
+}
+
+func formatCounts(counts []statsCount) string {
+	if len(counts) == 0 {
+		return "--"
+	}
+	parts := []string{}
+	for _, c := range counts {
+		parts = append(parts, fmt.Sprintf("%s (%d)", c.Name, c.Count))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *readingStats) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Finished: %d\n", s.Finished)
+	fmt.Fprintf(&sb, "DNF     : %d (%.0f%% of books stopped)\n", s.DNF, s.DNFRate*100)
+	if s.AverageDays == 0 {
+		fmt.Fprintf(&sb, "Days    : --\n")
+	} else {
+		fmt.Fprintf(&sb, "Days    : %g average, %g median\n", s.AverageDays, s.MedianDays)
+	}
+	switch {
+	case s.Pages == 0:
+		fmt.Fprintf(&sb, "Pages   : --\n")
+	case s.PagesUnknown > 0:
+		fmt.Fprintf(&sb, "Pages   : %d, %d books have no page count\n", s.Pages, s.PagesUnknown)
+	default:
+		fmt.Fprintf(&sb, "Pages   : %d\n", s.Pages)
+	}
+	fmt.Fprintf(&sb, "Genres  : %s\n", formatCounts(s.TopGenres))
+	fmt.Fprintf(&sb, "Authors : %s\n", formatCounts(s.TopAuthors))
+	fmt.Fprintf(&sb, "Streak  : %s now, longest %s\n", pluralDays(s.CurrentStreak.Days), pluralDays(s.LongestStreak.Days))
+
+	// a year is broken down by month, everything else by year
+	periods, label := s.ByYear, "Per year"
+	if s.Year != 0 {
+		periods, label = s.ByMonth, "Per month"
+	}
+	fmt.Fprintf(&sb, "\n%s\n", label)
+	for _, p := range periods {
+		fmt.Fprintf(&sb, "  %-7s  %3d\n", p.Name, p.Count)
+	}
+
+	for _, list := range []struct {
+		label string
+		reads []statsRead
+	}{{"Longest reads", s.Longest}, {"Shortest reads", s.Shortest}} {
+		fmt.Fprintf(&sb, "\n%s\n", list.label)
+		for _, r := range list.reads {
+			fmt.Fprintf(&sb, "  %6g days  %s by %s\n", r.Days, r.Title, r.Author)
+		}
+	}
+	return sb.String()
+}
+
+var statsCmd = &cli.Command{
+	Name:  "stats",
+	Usage: "numbers about your reading, from the books you have finished or stopped",
+	Commands: []*cli.Command{
+		chartCmd,
+	},
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:        "year",
+			Usage:       "only count books finished in `year`",
+			DefaultText: "every year",
+		},
+		formatFlag,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		db := ctx.Value(myCtx{}).(*sql.DB)
+		cfg := ctx.Value(configCtx{}).(config)
+		year := int(c.Int("year"))
+		books, err := statsBooks(db, year)
+		if err != nil {
+			return err
+		}
+
+		stats := computeStats(books, year)
+		stats.CurrentStreak, stats.LongestStreak, err = bookStreaks(db, cfg.defaults.streakStates, cfg.defaults.streakSpans, cfg.defaults.streakGraceDays, time.Now())
+		if err != nil {
+			return err
+		}
+		if outputFormat(c, cfg) == "json" {
+			return printJSON(stats)
+		}
+		fmt.Print(stats.String())
+		return nil
+	},
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// the states whose spans can be reading days, a tbr or none book was never read
+var STREAK_STATES = []BookState{BS_READING, BS_FINISHED, BS_DNF}
+
+// a run of reading days, missing at most the grace days in a row between
+// them. Days is the number of reading days, not counting the missed ones
+type streak struct {
+	Days  int       `json:"days"`
+	Start time.Time `json:"start,omitzero"`
+	End   time.Time `json:"end,omitzero"`
+}
+
+func pluralDays(n int) string {
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
+
+func (s streak) String() string {
+	if s.Days == 0 {
+		return "--"
+	}
+	return fmt.Sprintf("%s, %s to %s", pluralDays(s.Days), s.Start.Format(time.DateOnly), s.End.Format(time.DateOnly))
+}
+
+// the books read on each day, keyed by 2006-01-02 then book id. the days
+// come from the reading log, and with spans also from the span between
+// starting and finishing the books in states, see addSpanDays
+func readingDays(db *sql.DB, states []BookState, spans bool, now time.Time) (map[string]map[int64]bool, error) {
+	rows, err := db.Query("SELECT book_id, day FROM reading_log")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := map[string]map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		var day string
+		if err := rows.Scan(&id, &day); err != nil {
+			return nil, err
+		}
+		markDay(days, day, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !spans {
+		return days, nil
+	}
+
+	filter := bookFilter{}
+	filter.add("date_started IS NOT NULL")
+	books, err := queryBooks(db, filter)
+	if err != nil {
+		return nil, err
+	}
+	counted := []Book{}
+	for _, book := range books {
+		if slices.Contains(states, book.Status) {
+			counted = append(counted, book)
+		}
+	}
+	addSpanDays(days, counted, now)
+	return days, nil
+}
+
+// the days in days, in order
+func sortedDays(days map[string]map[int64]bool) []time.Time {
+	sorted := []time.Time{}
+	for day := range days {
+		t, _ := time.ParseInLocation(time.DateOnly, day, time.Local)
+		sorted = append(sorted, t)
+	}
+	slices.SortFunc(sorted, func(a, b time.Time) int { return a.Compare(b) })
+	return sorted
+}
+
+// the current and longest streaks in days, which must be sorted. the current
+// streak is the one still going today, which it is until more than grace days
+// have been missed since its last reading day
+func streaks(days []time.Time, grace int, now time.Time) (streak, streak) {
+	current, longest := streak{}, streak{}
+	for _, day := range days {
+		// calendar days, AddDate keeps this right across daylight saving
+		if current.Days > 0 && !day.After(current.End.AddDate(0, 0, grace+1)) {
+			current.Days++
+			current.End = day
+		} else {
+			current = streak{1, day, day}
+		}
+		if current.Days > longest.Days {
+			longest = current
+		}
+	}
+	if current.Days > 0 && midnight(now).After(current.End.AddDate(0, 0, grace+1)) {
+		current = streak{}
+	}
+	return current, longest
+}
+
+// the current and longest streaks from the reading days, see readingDays
+func bookStreaks(db *sql.DB, states []BookState, spans bool, grace int, now time.Time) (streak, streak, error) {
+	days, err := readingDays(db, states, spans, now)
+	if err != nil {
+		return streak{}, streak{}, err
+	}
+	current, longest := streaks(sortedDays(days), grace, now)
+	return current, longest, nil
+}
+
+// the book being read, when only one is
+func readingBook(db *sql.DB) (Book, error) {
+	filter := bookFilter{}
+	filter.add("status = ?", BS_READING)
+	books, err := queryBooks(db, filter)
+	if err != nil {
+		return Book{}, err
+	}
+	switch len(books) {
+	case 0:
+		return Book{}, errors.New("you are not reading any books, say which book you read")
+	case 1:
+		return books[0], nil
+	default:
+		return Book{}, fmt.Errorf("you are reading %d books, say which one you read", len(books))
+	}
+}
+
+var logCmd = &cli.Command{
+	Name:        "log",
+	Usage:       "record a day you read a book, streaks and the reading calendar are made from these",
+	Description: "without a book the one you are reading is used, as long as you are only reading one",
+	Arguments:   commonArgs,
+	ArgsUsage:   "[[title author]|ISBN|id]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "date",
+			Aliases:     []string{"d"},
+			Usage:       "the `date` you read the book, 2006-01-02 or 'yesterday', 'last friday', '3 days ago', 'oct 3'",
+			DefaultText: "today",
+			Action:      validDateAction,
+		},
+		&cli.BoolFlag{
+			Name:  "remove",
+			Usage: "remove the day from the log instead",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		db := ctx.Value(myCtx{}).(*sql.DB)
+		var book Book
+		var err error
+		if c.StringArg("title") == "" && !c.Bool("ISBN") {
+			book, err = readingBook(db)
+		} else {
+			book, err = resolveBookArgs(db, c)
+		}
+		if err != nil {
+			return err
+		}
+
+		date, err := flagDateEcho(c, "date")
+		if err != nil {
+			return err
+		}
+		if date.After(time.Now()) {
+			return fmt.Errorf("can not log reading on %s, it has not happened yet", date.Format(time.DateOnly))
+		}
+		day := midnight(date).Format(time.DateOnly)
+
+		if c.Bool("remove") {
+			res, err := db.Exec("DELETE FROM reading_log WHERE book_id = ? AND day = ?", book.ID, day)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return fmt.Errorf("'%s' was not logged on %s", book.Title, day)
+			}
+			fmt.Fprintf(os.Stderr, "INFO: removed reading '%s' on %s from the log\n", book.Title, day)
+			return nil
+		}
+		_, err = db.Exec("INSERT OR IGNORE INTO reading_log (book_id, day) VALUES(?, ?)", book.ID, day)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "INFO: logged reading '%s' on %s\n", book.Title, day)
+		return nil
+	},
+}
+
+var streakCmd = &cli.Command{
+	Name:  "streak",
+	Usage: "show your current and longest run of days spent reading",
+	Description: "a reading day is a day in the reading log, see `log`. with --spans, or streak_spans in the\n" +
+		"config, every day between starting a book and finishing it counts too, streak_states picks which\n" +
+		"books those are. streak_grace_days is how many days in a row can be missed without breaking a streak",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:        "grace",
+			Usage:       "how many `days` in a row can be missed without breaking a streak",
+			DefaultText: "streak_grace_days from config",
+		},
+		&cli.BoolFlag{
+			Name:        "spans",
+			Usage:       "also count the days between starting and finishing a book",
+			DefaultText: "streak_spans from config",
+		},
+		formatFlag,
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		db := ctx.Value(myCtx{}).(*sql.DB)
+		cfg := ctx.Value(configCtx{}).(config)
+		grace := cfg.defaults.streakGraceDays
+		if c.IsSet("grace") {
+			if c.Int("grace") < 0 {
+				return errors.New("--grace can not be negative")
+			}
+			grace = int(c.Int("grace"))
+		}
+
+		spans := cfg.defaults.streakSpans
+		if c.IsSet("spans") {
+			spans = c.Bool("spans")
+		}
+
+		current, longest, err := bookStreaks(db, cfg.defaults.streakStates, spans, grace, time.Now())
+		if err != nil {
+			return err
+		}
+		if outputFormat(c, cfg) == "json" {
+			return printJSON(struct {
+				Current streak `json:"current"`
+				Longest streak `json:"longest"`
+				Grace   int    `json:"grace_days"`
+			}{current, longest, grace})
+		}
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Current : %s\n", current)
+		fmt.Fprintf(&sb, "Longest : %s\n", longest)
+		if grace > 0 {
+			fmt.Fprintf(&sb, "Grace   : %s in a row can be missed\n", pluralDays(grace))
+		}
+		fmt.Print(sb.String())
+		return nil
+	},
+}
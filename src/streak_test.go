@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreaks(t *testing.T) {
+	setLocal(t, "America/New_York")
+	days := func(ds ...string) []time.Time {
+		times := []time.Time{}
+		for _, d := range ds {
+			day, err := time.ParseInLocation(time.DateOnly, d, time.Local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			times = append(times, day)
+		}
+		return times
+	}
+	at := func(d string) time.Time {
+		return days(d)[0].Add(12 * time.Hour)
+	}
+
+	tests := []struct {
+		name    string
+		days    []time.Time
+		grace   int
+		now     time.Time
+		current string
+		longest string
+	}{
+		{"no days", days(), 0, at("2026-01-05"), "--", "--"},
+		{"read today", days("2026-01-01", "2026-01-02", "2026-01-03"), 0, at("2026-01-03"),
+			"3 days, 2026-01-01 to 2026-01-03", "3 days, 2026-01-01 to 2026-01-03"},
+		// not reading yet today does not break it
+		{"read yesterday", days("2026-01-01", "2026-01-02", "2026-01-03"), 0, at("2026-01-04"),
+			"3 days, 2026-01-01 to 2026-01-03", "3 days, 2026-01-01 to 2026-01-03"},
+		{"broken", days("2026-01-01", "2026-01-02", "2026-01-03"), 0, at("2026-01-05"),
+			"--", "3 days, 2026-01-01 to 2026-01-03"},
+		{"gap", days("2026-01-01", "2026-01-02", "2026-01-04"), 0, at("2026-01-04"),
+			"1 day, 2026-01-04 to 2026-01-04", "2 days, 2026-01-01 to 2026-01-02"},
+		// the missed day is within the grace days, and is not counted
+		{"grace", days("2026-01-01", "2026-01-02", "2026-01-04"), 1, at("2026-01-04"),
+			"3 days, 2026-01-01 to 2026-01-04", "3 days, 2026-01-01 to 2026-01-04"},
+		{"grace kept", days("2026-01-01", "2026-01-02"), 2, at("2026-01-05"),
+			"2 days, 2026-01-01 to 2026-01-02", "2 days, 2026-01-01 to 2026-01-02"},
+		{"grace used up", days("2026-01-01", "2026-01-02"), 2, at("2026-01-06"),
+			"--", "2 days, 2026-01-01 to 2026-01-02"},
+		{"longest before", days("2026-01-01", "2026-01-02", "2026-01-03", "2026-01-10"), 0, at("2026-01-10"),
+			"1 day, 2026-01-10 to 2026-01-10", "3 days, 2026-01-01 to 2026-01-03"},
+		// march 8 is 23 hours long and november 1 is 25, neither breaks a streak
+		{"spring forward", days("2026-03-07", "2026-03-08", "2026-03-09"), 0, at("2026-03-10"),
+			"3 days, 2026-03-07 to 2026-03-09", "3 days, 2026-03-07 to 2026-03-09"},
+		{"fall back", days("2026-10-31", "2026-11-01", "2026-11-02"), 0, at("2026-11-02"),
+			"3 days, 2026-10-31 to 2026-11-02", "3 days, 2026-10-31 to 2026-11-02"},
+		{"fall back grace", days("2026-10-30", "2026-11-02"), 2, at("2026-11-02"),
+			"2 days, 2026-10-30 to 2026-11-02", "2 days, 2026-10-30 to 2026-11-02"},
+	}
+
+	for _, test := range tests {
+		current, longest := streaks(test.days, test.grace, test.now)
+		if current.String() != test.current || longest.String() != test.longest {
+			t.Errorf("%s: streaks() = %q, %q, want %q, %q", test.name, current, longest, test.current, test.longest)
+		}
+	}
+}
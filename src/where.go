@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v3"
+)
+
+// the fields that can be used in --where, aliases map to the same field
+var WHERE_FIELDS = []string{"id", "isbn", "title", "author", "series", "status", "genre", "rating", "started", "finished"}
+
+var WHERE_ALIASES = map[string]string{"state": "status", "genres": "genre"}
+
+// longest first so >= is not read as >
+var WHERE_OPERATORS = []string{">=", "<=", "!=", ":", "=", ">", "<"}
+
+// an error in a --where expression, it points at the token that caused it
+type WhereError struct {
+	Input string
+	Pos   int
+	Len   int
+	Msg   string
+}
+
+// Pos and Len are in bytes, the caret is lined up in runes so it still points
+// at the token when the input has accents or other multi byte characters
+func (e *WhereError) Error() string {
+	pos := min(e.Pos, len(e.Input))
+	end := min(pos+e.Len, len(e.Input))
+	return fmt.Sprintf("invalid --where: %s\n  %s\n  %s%s",
+		e.Msg, e.Input, strings.Repeat(" ", utf8.RuneCountInString(e.Input[:pos])),
+		strings.Repeat("^", max(1, utf8.RuneCountInString(e.Input[pos:end]))))
+}
+
+type whereToken struct {
+	text string
+	pos  int
+}
+
+// splits the input into parens and words, quotes group spaces and parens into
+// a word and are removed
+func tokenizeWhere(input string) ([]whereToken, error) {
+	tokens := []whereToken{}
+	ix := 0
+	for ix < len(input) {
+		switch input[ix] {
+		case ' ', '\t', '\n':
+			ix++
+			continue
+		case '(', ')':
+			tokens = append(tokens, whereToken{input[ix : ix+1], ix})
+			ix++
+			continue
+		}
+
+		start := ix
+		var sb strings.Builder
+		for ix < len(input) && !strings.ContainsRune(" \t\n()", rune(input[ix])) {
+			if input[ix] != '"' {
+				sb.WriteByte(input[ix])
+				ix++
+				continue
+			}
+			end := strings.IndexByte(input[ix+1:], '"')
+			if end == -1 {
+				return nil, &WhereError{input, ix, len(input) - ix, "unterminated quote"}
+			}
+			sb.WriteString(input[ix+1 : ix+1+end])
+			ix += end + 2
+		}
+		tokens = append(tokens, whereToken{sb.String(), start})
+	}
+	return tokens, nil
+}
+
+// a recursive descent parser over the tokens, it builds the sql as it goes
+//
+//	expr  = and { "OR" and }
+//	and   = unary { [ "AND" ] unary }
+//	unary = ( "NOT" | "-" ) unary | "(" expr ")" | field op value
+type whereParser struct {
+	input  string
+	tokens []whereToken
+	pos    int
+	args   []any
+}
+
+func (p *whereParser) errorAt(tok whereToken, format string, a ...any) error {
+	return &WhereError{p.input, tok.pos, len(tok.text), fmt.Sprintf(format, a...)}
+}
+
+func (p *whereParser) peek() (whereToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return whereToken{pos: len(p.input)}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *whereParser) parseExpr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.text != "OR" {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = left + " OR " + right
+	}
+}
+
+func (p *whereParser) parseAnd() (string, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return "", err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.text == ")" || tok.text == "OR" {
+			return "(" + left + ")", nil
+		}
+		if tok.text == "AND" {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		left = left + " AND " + right
+	}
+}
+
+func (p *whereParser) parseUnary() (string, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return "", p.errorAt(tok, "expected a condition but the expression ended")
+	}
+
+	switch {
+	case tok.text == "NOT":
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		return not(inner), nil
+	case tok.text == "(":
+		p.pos++
+		inner, err := p.parseExpr()
+		if err != nil {
+			return "", err
+		}
+		end, ok := p.peek()
+		if !ok || end.text != ")" {
+			return "", p.errorAt(tok, "this '(' is never closed")
+		}
+		p.pos++
+		return "(" + inner + ")", nil
+	case tok.text == ")":
+		return "", p.errorAt(tok, "unexpected ')'")
+	case tok.text == "AND" || tok.text == "OR":
+		return "", p.errorAt(tok, "expected a condition before '%s'", tok.text)
+	case strings.HasPrefix(tok.text, "-") && len(tok.text) > 1:
+		p.pos++
+		inner, err := p.parseTerm(whereToken{tok.text[1:], tok.pos + 1})
+		if err != nil {
+			return "", err
+		}
+		return not(inner), nil
+	default:
+		p.pos++
+		return p.parseTerm(tok)
+	}
+}
+
+// negates a condition. a condition on a missing date is NULL, which NOT keeps
+// as NULL, so it is counted as false first to keep books without the date
+func not(condition string) string {
+	return "NOT COALESCE(" + condition + ", 0)"
+}
+
+var WHERE_FIELD_RE = regexp.MustCompile(`^[a-z_]+`)
+
+// field op value, like status:finished or started>=2025
+func (p *whereParser) parseTerm(tok whereToken) (string, error) {
+	field := WHERE_FIELD_RE.FindString(strings.ToLower(tok.text))
+	rest := tok.text[len(field):]
+	fieldTok := whereToken{tok.text[:len(field)], tok.pos}
+	if field == "" {
+		return "", p.errorAt(tok, "expected a condition like field:value, not '%s'", tok.text)
+	}
+
+	op := ""
+	for _, o := range WHERE_OPERATORS {
+		if strings.HasPrefix(rest, o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return "", p.errorAt(tok, "'%s' is missing an operator, use one of '%s'", tok.text, strings.Join(WHERE_OPERATORS, "' '"))
+	}
+	value := rest[len(op):]
+	valueTok := whereToken{value, tok.pos + len(field) + len(op)}
+	if value == "" {
+		return "", p.errorAt(tok, "'%s' is missing a value", tok.text)
+	}
+
+	if alias, ok := WHERE_ALIASES[field]; ok {
+		field = alias
+	}
+	switch field {
+	case "id":
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", p.errorAt(valueTok, "'%s' is not a valid id", value)
+		}
+		return p.compare("id", op, id)
+	case "isbn":
+		if op != ":" && op != "=" && op != "!=" {
+			return "", p.errorAt(fieldTok, "isbn can only be compared with ':' '=' '!='")
+		}
+		isbn := canonicalISBN(value)
+		sql := "COALESCE(isbn, '') = ?"
+		p.args = append(p.args, isbn)
+		if op == "!=" {
+			return "NOT " + sql, nil
+		}
+		return sql, nil
+	case "author":
+		switch op {
+		case ":":
+			p.args = append(p.args, "%"+normaliseName(value)+"%")
+			return AUTHOR_MATCH, nil
+		case "=":
+			p.args = append(p.args, normaliseName(value))
+			return AUTHOR_MATCH, nil
+		case "!=":
+			p.args = append(p.args, "%"+normaliseName(value)+"%")
+			return "NOT " + AUTHOR_MATCH, nil
+		default:
+			return "", p.errorAt(fieldTok, "author can only be compared with ':' '=' '!='")
+		}
+	case "title", "series":
+		return p.text(field+"_key", op, normaliseName(value))
+	case "genre":
+		if op != ":" && op != "=" && op != "!=" {
+			return "", p.errorAt(fieldTok, "genre can only be compared with ':' '=' '!='")
+		}
+		sql := "(',' || COALESCE(genres, '') || ',') LIKE ?"
+		p.args = append(p.args, "%,"+strings.ToLower(value)+",%")
+		if op == "!=" {
+			return "NOT " + sql, nil
+		}
+		return sql, nil
+	case "status":
+		state, err := parseBookState(value)
+		if err != nil {
+			return "", p.errorAt(valueTok, "%s", err)
+		}
+		if op != ":" && op != "=" && op != "!=" {
+			return "", p.errorAt(fieldTok, "status can only be compared with ':' '=' '!='")
+		}
+		return p.compare("status", op, state)
+	case "rating":
+		rating, err := strconv.Atoi(value)
+		if err != nil || rating < 1 || rating > 5 {
+			return "", p.errorAt(valueTok, "'%s' is not a valid rating, it must be from 1 to 5", value)
+		}
+		// an unrated book is NULL so it only matches when negated
+		if op == "!=" {
+			p.args = append(p.args, rating)
+			return not("rating = ?"), nil
+		}
+		return p.compare("rating", op, rating)
+	case "started", "finished":
+		start, end, err := parsePeriod(value)
+		if err != nil {
+			return "", p.errorAt(valueTok, "%s", err)
+		}
+		return p.period("unixepoch(date_"+field+")", op, start.Unix(), end.Unix()), nil
+	default:
+		return "", p.errorAt(fieldTok, "unknown field '%s', must be one of '%s'", field, strings.Join(WHERE_FIELDS, "' '"))
+	}
+}
+
+func (p *whereParser) compare(column, op string, value any) (string, error) {
+	if op == ":" {
+		op = "="
+	}
+	p.args = append(p.args, value)
+	return fmt.Sprintf("%s %s ?", column, op), nil
+}
+
+// ':' is a substring match, '=' an exact match and the rest compare
+// alphabetically
+func (p *whereParser) text(column, op, value string) (string, error) {
+	switch op {
+	case ":":
+		p.args = append(p.args, "%"+value+"%")
+		return column + " LIKE ?", nil
+	case "!=":
+		p.args = append(p.args, "%"+value+"%")
+		return column + " NOT LIKE ?", nil
+	default:
+		return p.compare(column, op, value)
+	}
+}
+
+// compares against the period [start, end), ':' and '=' mean within it
+func (p *whereParser) period(column, op string, start, end int64) string {
+	switch op {
+	case ">":
+		p.args = append(p.args, end)
+		return column + " >= ?"
+	case ">=":
+		p.args = append(p.args, start)
+		return column + " >= ?"
+	case "<":
+		p.args = append(p.args, start)
+		return column + " < ?"
+	case "<=":
+		p.args = append(p.args, end)
+		return column + " < ?"
+	case "!=":
+		p.args = append(p.args, start, end)
+		return not(fmt.Sprintf("(%s >= ? AND %s < ?)", column, column))
+	default:
+		p.args = append(p.args, start, end)
+		return fmt.Sprintf("(%s >= ? AND %s < ?)", column, column)
+	}
+}
+
+var YEAR_RE = regexp.MustCompile(`^\d{4}$`)
+
+// the period a date covers, a year, a month, a day or, if it has a time, a
+// second
+func parsePeriod(s string) (time.Time, time.Time, error) {
+	if YEAR_RE.MatchString(s) {
+		year, _ := strconv.Atoi(s)
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+		return start, start.AddDate(1, 0, 0), nil
+	}
+	if month, err := time.ParseInLocation("2006-01", s, time.Local); err == nil {
+		return month, month.AddDate(0, 1, 0), nil
+	}
+	t, err := parseDate(s)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if t.Equal(midnight(t)) {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	return t, t.Add(time.Second), nil
+}
+
+// compiles a --where expression to sql that can be added to a bookFilter
+func parseWhere(input string) (string, []any, error) {
+	tokens, err := tokenizeWhere(input)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(tokens) == 0 {
+		return "", nil, &WhereError{input, 0, 0, "the expression is empty"}
+	}
+
+	p := whereParser{input: input, tokens: tokens}
+	sql, err := p.parseExpr()
+	if err != nil {
+		return "", nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return "", nil, p.errorAt(tok, "unexpected '%s'", tok.text)
+	}
+	return sql, p.args, nil
+}
+
+func validWhereAction(_ context.Context, _ *cli.Command, s string) error {
+	_, _, err := parseWhere(s)
+	return err
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWhere(t *testing.T) {
+	tests := []struct {
+		input string
+		sql   string
+		args  []any
+	}{
+		{"status:finished", "(status = ?)", []any{BS_FINISHED}},
+		{"title:dune", "(title_key LIKE ?)", []any{"%dune%"}},
+		{"title=dune", "(title_key = ?)", []any{"dune"}},
+		{"title!=dune", "(title_key NOT LIKE ?)", []any{"%dune%"}},
+		{`series:"the stormlight archive"`, "(series_key LIKE ?)", []any{"%the stormlight archive%"}},
+		{"id>=3", "(id >= ?)", []any{int64(3)}},
+		{"rating>3", "(rating > ?)", []any{3}},
+		{"rating!=3", "(NOT COALESCE(rating = ?, 0))", []any{3}},
+		{"isbn:0-575-04800-X", "(COALESCE(isbn, '') = ?)", []any{"9780575048003"}},
+		{"genre:fantasy", "((',' || COALESCE(genres, '') || ',') LIKE ?)", []any{"%,fantasy,%"}},
+		{"status:reading OR status:tbr", "(status = ?) OR (status = ?)", []any{BS_READING, BS_TBR}},
+		{"status:reading AND title:a", "(status = ? AND title_key LIKE ?)", []any{BS_READING, "%a%"}},
+		{"-title:a", "(NOT COALESCE(title_key LIKE ?, 0))", []any{"%a%"}},
+		{"NOT (title:a OR title:b)", "(NOT COALESCE(((title_key LIKE ?) OR (title_key LIKE ?)), 0))", []any{"%a%", "%b%"}},
+	}
+
+	for _, test := range tests {
+		sql, args, err := parseWhere(test.input)
+		if err != nil || sql != test.sql || !slices.Equal(args, test.args) {
+			t.Errorf("parseWhere(%q) = %q, %v, %v, want %q, %v", test.input, sql, args, err, test.sql, test.args)
+		}
+	}
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		// the line with the caret, which has to line up under the input
+		caret string
+	}{
+		{"", "  ^"},
+		{"bogus:1", "  ^^^^^"},
+		{"title", "  ^^^^^"},
+		{"title:", "  ^^^^^^"},
+		{"rating:6", "         ^"},
+		{"rating:abc", "         ^^^"},
+		{"isbn>1", "  ^^^^"},
+		{"(title:a", "  ^"},
+		{"title:a)", "         ^"},
+		{`title:"dune`, "        ^^^^^"},
+		{"status:finished OR", "                    ^"},
+		// the caret counts runes, not bytes, so accents do not push it along
+		{"author:gaimán bogus:1", "                ^^^^^"},
+		{`title:"日本語" rating:9`, "                     ^"},
+	}
+
+	for _, test := range tests {
+		_, _, err := parseWhere(test.input)
+		var whereErr *WhereError
+		if !errors.As(err, &whereErr) {
+			t.Errorf("parseWhere(%q) = %v, want a *WhereError", test.input, err)
+			continue
+		}
+		lines := strings.Split(err.Error(), "\n")
+		if got := lines[len(lines)-1]; got != test.caret {
+			t.Errorf("parseWhere(%q) caret = %q, want %q", test.input, got, test.caret)
+		}
+	}
+}
+
+func TestWhereMatches(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	db := testDB(t,
+		Book{Title: "Good Omens", Author: "Terry Pratchett & Neil Gaiman", Status: BS_FINISHED,
+			Started: date("2025-05-01"), Finished: date("2025-05-04"), Genres: []string{"fantasy"}, Rating: 4},
+		Book{Title: "Anathem", Author: "Neal Stephenson", Status: BS_TBR},
+		Book{Title: "Mort", Author: "Terry Pratchett", Status: BS_FINISHED,
+			Started: date("2026-03-10"), Finished: date("2026-03-12"), Genres: []string{"fantasy", "humour"}, Rating: 2},
+		Book{Title: "Ulysses", Author: "James Joyce", Status: BS_READING, Started: date("2026-03-01")},
+	)
+
+	tests := []struct {
+		input string
+		want  []int64
+	}{
+		{"finished:2025", []int64{1}},
+		{"finished>=2025-06", []int64{3}},
+		// a book without the date does not match a date, but does match its negation
+		{"-finished:2025", []int64{2, 3, 4}},
+		{"NOT finished:2025", []int64{2, 3, 4}},
+		{"finished!=2025", []int64{2, 3, 4}},
+		{"NOT finished<2026", []int64{2, 3, 4}},
+		{"started:2026-03", []int64{3, 4}},
+		{"-started:2026-03", []int64{1, 2}},
+		{"rating>3", []int64{1}},
+		{"rating<=2", []int64{3}},
+		{"rating!=4", []int64{2, 3, 4}},
+		{"-rating>=2", []int64{2, 4}},
+		{"author:pratchett", []int64{1, 3}},
+		{`author="neal stephenson"`, []int64{2}},
+		{"-author:gaiman", []int64{2, 3, 4}},
+		{"genre:humour", []int64{3}},
+		{"genre!=fantasy", []int64{2, 4}},
+		{"(genre:fantasy OR status:tbr) -rating:4", []int64{2, 3}},
+		{"status:reading OR title:mort", []int64{3, 4}},
+	}
+
+	for _, test := range tests {
+		sql, args, err := parseWhere(test.input)
+		if err != nil {
+			t.Errorf("parseWhere(%q) = %v", test.input, err)
+			continue
+		}
+		filter := bookFilter{}
+		filter.add(sql, args...)
+		books, err := queryBooks(db, filter)
+		if err != nil {
+			t.Errorf("where %q: %v", test.input, err)
+			continue
+		}
+		got := []int64{}
+		for _, book := range books {
+			got = append(got, book.ID)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("where %q matched %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	setLocal(t, "America/New_York")
+	local := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.Local)
+	}
+
+	tests := []struct {
+		input      string
+		start, end time.Time
+		ok         bool
+	}{
+		{input: "2025", start: local(2025, time.January, 1, 0, 0, 0), end: local(2026, time.January, 1, 0, 0, 0), ok: true},
+		{input: "2026-02", start: local(2026, time.February, 1, 0, 0, 0), end: local(2026, time.March, 1, 0, 0, 0), ok: true},
+		{input: "2025-12", start: local(2025, time.December, 1, 0, 0, 0), end: local(2026, time.January, 1, 0, 0, 0), ok: true},
+		// the day the clocks go forward is 23 hours long, and still one day
+		{input: "2026-03-08", start: local(2026, time.March, 8, 0, 0, 0), end: local(2026, time.March, 9, 0, 0, 0), ok: true},
+		{input: "2026-03-08T10:30", start: local(2026, time.March, 8, 10, 30, 0), end: local(2026, time.March, 8, 10, 30, 1), ok: true},
+		{input: "20x5"},
+		{input: "2026-13"},
+	}
+
+	for _, test := range tests {
+		start, end, err := parsePeriod(test.input)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("parsePeriod(%q) = %v, %v, want an error", test.input, start, end)
+			}
+			continue
+		}
+		if err != nil || !start.Equal(test.start) || !end.Equal(test.end) {
+			t.Errorf("parsePeriod(%q) = %v, %v, %v, want %v, %v", test.input, start, end, err, test.start, test.end)
+		}
+	}
+}